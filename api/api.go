@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	"pkg/tcw.im/rtfd/assets"
+	"pkg/tcw.im/rtfd/pkg/build"
 	"pkg/tcw.im/rtfd/pkg/lib"
 
 	"github.com/labstack/echo/v4"
@@ -29,6 +30,7 @@ import (
 var (
 	pm      *lib.ProjectManager
 	cfgFile string
+	builder *build.Builder
 )
 
 // Start 启动web服务
@@ -40,6 +42,17 @@ func Start(host string, port uint, cfg string) {
 	pm = ipm
 	cfgFile = cfg
 
+	b, err := build.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	builder = b
+	// API服务仅将构建任务加入队列，由内置或其他主机上的worker运行
+	for i := 0; i < pm.CFG().MustInt("build", "workers", 2); i++ {
+		go build.NewWorker(b, i).Run(nil)
+	}
+	go schedule()
+
 	if host == "" {
 		host = "0.0.0.0"
 	}
@@ -64,6 +77,10 @@ func Start(host string, port uint, cfg string) {
 	g.POST("/:name/build", apiBuild)
 	g.POST("/build/:name", apiBuild)
 
+	g.GET("/:name/builds", apiBuilds)
+	g.GET("/:name/builds/:id/log", apiBuildLog)
+	g.POST("/:name/builds/:id/cancel", apiBuildCancel)
+
 	g.POST("/:name/webhook", webhookBuild)
 	g.POST("/webhook/:name", webhookBuild)
 
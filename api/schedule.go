@@ -0,0 +1,82 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"pkg/tcw.im/rtfd/pkg/util"
+	"pkg/tcw.im/rtfd/vars"
+)
+
+// schedule 每分钟检查一次项目的定时构建设置，到时则将其 latest 分支加入构建队列。
+// 定时设置保存在项目配置中，每次检查时读取，服务重启后依然有效。
+func schedule() {
+	for {
+		next := time.Now().Truncate(time.Minute).Add(time.Minute)
+		time.Sleep(time.Until(next))
+		scheduleBuilds(next)
+	}
+}
+
+// scheduleBuilds 将定时设置满足时间 t 的项目加入构建队列
+func scheduleBuilds(t time.Time) {
+	// 多个API服务实例中，每分钟仅由获取到锁的实例加入构建
+	host, _ := os.Hostname()
+	ok, err := pm.ScheduleLock(t, fmt.Sprintf("%s:%d", host, os.Getpid()))
+	if err != nil {
+		log.Printf("schedule: lock failed: %s\n", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	opts, err := pm.ListFullProject()
+	if err != nil {
+		log.Printf("schedule: list project failed: %s\n", err)
+		return
+	}
+	for _, opt := range opts {
+		if opt.Schedule == "" {
+			continue
+		}
+		cron, err := util.ParseCron(opt.Schedule)
+		if err != nil {
+			log.Printf("schedule: invalid schedule of %s: %s\n", opt.Name, err)
+			continue
+		}
+		if !cron.Match(t) {
+			continue
+		}
+		task, err := builder.NewTask(opt.Name, "", vars.ScheduleSender)
+		if err != nil {
+			log.Printf("schedule: %s: %s\n", opt.Name, err)
+			continue
+		}
+		// 定时构建用于更新依赖或外部资源，提交未变化时也要构建
+		task.Force = true
+		task, err = builder.Enqueue(task)
+		if err != nil {
+			log.Printf("schedule: %s: %s\n", opt.Name, err)
+			continue
+		}
+		log.Printf("schedule: build %s(%s) %s\n", opt.Name, task.ID, task.Branch)
+	}
+}
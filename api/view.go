@@ -20,12 +20,12 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
-	"pkg/tcw.im/rtfd/pkg/build"
 	"pkg/tcw.im/rtfd/pkg/lib"
 	"pkg/tcw.im/rtfd/pkg/util"
 	"pkg/tcw.im/rtfd/vars"
@@ -43,6 +43,10 @@ type resb struct {
 	res
 	Branch string `json:"branch"`
 }
+type resq struct {
+	resb
+	ID string `json:"id"`
+}
 type resp struct {
 	res
 	Ping string `json:"ping"`
@@ -89,9 +93,11 @@ func apiDesc(c echo.Context) error {
 	data["sourceDir"] = opt.SourceDir
 	data["single"] = opt.Single
 	data["builder"] = opt.Builder
+	data["engine"] = opt.Engine
 	data["showNav"] = opt.ShowNav
 	data["defaultBranch"] = pm.CFG().DefaultBranch()
-	if opt.Builder != "html" {
+	// 仅 Sphinx html 构建器的页面路径可对应到源文件
+	if opt.Builder != "html" || opt.IsMkDocs() {
 		data["hideGit"] = true
 	} else {
 		data["hideGit"] = opt.HideGit
@@ -104,6 +110,9 @@ func apiDesc(c echo.Context) error {
 		return c.JSON(200, res{Message: "invalid data directory"})
 	}
 	versions := make(map[string][]string)
+	stable := ""
+	// 构建时保存的远程仓库标签，用于区分标签与分支
+	isTag, _ := pm.Tags(name)
 	for _, lang := range strings.Split(opt.Lang, ",") {
 		langDir := filepath.Join(basedir, "docs", name, lang)
 		if gtc.IsDir(langDir) {
@@ -114,22 +123,122 @@ func apiDesc(c echo.Context) error {
 			vs := []string{"latest"}
 			for _, f := range ifs {
 				name := f.Name()
-				if f.IsDir() && name != "" && name != "." && name != ".." {
+				// 已发布的版本是指向暂存目录的链接，以 . 开头的为暂存或临时目录
+				if name == "" || name == "latest" || strings.HasPrefix(name, ".") || opt.IsHidden(name) {
+					continue
+				}
+				if gtc.IsDir(filepath.Join(langDir, name)) {
 					vs = append(vs, name)
 				}
 			}
+			if stable == "" {
+				stable = stableVersion(opt, langDir)
+			}
 			if vs != nil {
 				if len(vs) == 1 && vs[0] == "latest" {
 					continue
 				}
+				util.SortVersions(vs, isTag)
 				versions[lang] = vs
 			}
 		}
 	}
 	data["versions"] = versions
+	data["stable"] = stable
+	// 版本别名，别名本身也是版本列表中的一项
+	aliases := make(map[string]string)
+	for alias, target := range opt.Aliases {
+		if !opt.IsHidden(alias) {
+			aliases[alias] = target
+		}
+	}
+	data["aliases"] = aliases
+	// 各分支最近一次构建所用的提交
+	builds := make(map[string]interface{})
+	if rsts, err := pm.ListBuildset(name); err == nil {
+		for _, rst := range rsts {
+			if rst.Commit == "" {
+				continue
+			}
+			builds[rst.Branch] = map[string]interface{}{
+				"commit":   rst.Commit,
+				"author":   rst.CommitAuthor,
+				"subject":  rst.CommitSubject,
+				"date":     rst.CommitTime,
+				"btime":    rst.Btime,
+				"warnings": rst.Warnings,
+			}
+		}
+	}
+	data["builds"] = builds
+	data["downloads"] = listDownloads(filepath.Join(basedir, "docs", name, "_downloads"))
 	return c.JSON(200, resd{res{Success: true}, data})
 }
 
+// stableVersion stable 所指向的版本，可以是手动设置的别名或自动维护的链接
+func stableVersion(opt lib.Options, langDir string) string {
+	if target, ok := opt.Aliases["stable"]; ok {
+		return target
+	}
+	target, err := os.Readlink(filepath.Join(langDir, "stable"))
+	if err != nil {
+		return ""
+	}
+	if rel, err := filepath.Rel(langDir, target); err == nil {
+		return rel
+	}
+	return ""
+}
+
+// listDownloads 列出各语言各版本的下载文件，即 lang -> branch -> format -> url，
+// 含 / 的分支（如 feature/x）的下载文件位于多级目录中
+func listDownloads(dir string) map[string]map[string]map[string]string {
+	exts := map[string]string{".pdf": "pdf", ".epub": "epub", ".zip": "htmlzip"}
+	downloads := make(map[string]map[string]map[string]string)
+	langs, err := os.ReadDir(dir)
+	if err != nil {
+		return downloads
+	}
+	for _, lang := range langs {
+		if !lang.IsDir() || strings.HasPrefix(lang.Name(), ".") {
+			continue
+		}
+		root := filepath.Join(dir, lang.Name())
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			// 以 . 开头的为发布时的临时目录
+			if strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			format, ok := exts[filepath.Ext(d.Name())]
+			if d.IsDir() || !ok {
+				return nil
+			}
+			rel, err := filepath.Rel(root, filepath.Dir(path))
+			if err != nil || rel == "." {
+				return nil
+			}
+			branch := filepath.ToSlash(rel)
+			if downloads[lang.Name()] == nil {
+				downloads[lang.Name()] = make(map[string]map[string]string)
+			}
+			if downloads[lang.Name()][branch] == nil {
+				downloads[lang.Name()][branch] = make(map[string]string)
+			}
+			downloads[lang.Name()][branch][format] = strings.Join(
+				[]string{"", "_downloads", lang.Name(), branch, d.Name()}, "/",
+			)
+			return nil
+		})
+	}
+	return downloads
+}
+
 func apiBuild(c echo.Context) error {
 	if ok, err := checkSecret(c); !ok {
 		return err
@@ -140,12 +249,103 @@ func apiBuild(c echo.Context) error {
 		return c.JSON(200, res{Message: "Not Found"})
 	}
 
-	b, err := build.New(cfgFile)
+	t, err := builder.NewTask(name, branch, vars.APISender)
+	if err != nil {
+		return err
+	}
+	t.Force = gtc.IsTrue(getArg(c, "force"))
+	t, err = builder.Enqueue(t)
+	if err != nil {
+		return err
+	}
+	return c.JSON(201, resq{resb{res{Success: true}, t.Branch}, t.ID})
+}
+
+func apiBuilds(c echo.Context) error {
+	name := c.Param("name")
+	if !pm.HasName(name) {
+		return c.JSON(200, res{Message: "Not Found"})
+	}
+	ok, err := checkSecret(c)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("verify signature failed")
+	}
+
+	page, _ := strconv.Atoi(getArg(c, "page"))
+	limit, _ := strconv.Atoi(getArg(c, "limit"))
+	h, err := pm.ListHistory(name, page, limit)
 	if err != nil {
 		return err
 	}
-	go b.BuildWithLog(name, branch, vars.APISender)
-	return c.JSON(201, resb{res{Success: true}, branch})
+	data := make(map[string]interface{})
+	data["total"] = h.Total
+	data["page"] = h.Page
+	data["limit"] = h.Limit
+	data["builds"] = h.Builds
+	return c.JSON(200, resd{res{Success: true}, data})
+}
+
+func apiBuildLog(c echo.Context) error {
+	name := c.Param("name")
+	if !pm.HasName(name) {
+		return c.JSON(200, res{Message: "Not Found"})
+	}
+	ok, err := checkSecret(c)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("verify signature failed")
+	}
+
+	rst, err := pm.GetBuildByID(name, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	// 构建运行在其他主机时，读取worker上传的日志
+	if rst.Log == "" || !gtc.IsFile(rst.Log) {
+		text, err := pm.GetLog(rst.ID)
+		if err != nil {
+			return err
+		}
+		return c.String(200, text)
+	}
+	text, err := os.ReadFile(rst.Log)
+	if err != nil {
+		return err
+	}
+	return c.Blob(200, echo.MIMETextPlainCharsetUTF8, text)
+}
+
+func apiBuildCancel(c echo.Context) error {
+	name := c.Param("name")
+	if !pm.HasName(name) {
+		return c.JSON(200, res{Message: "Not Found"})
+	}
+	ok, err := checkSecret(c)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("verify signature failed")
+	}
+
+	id := c.Param("id")
+	r, err := pm.GetRunning(id)
+	if err != nil {
+		return err
+	}
+	if r.Name != strings.ToLower(name) {
+		return errors.New("not found running build")
+	}
+	err = builder.Cancel(id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(200, res{Success: true})
 }
 
 func webhookBuild(c echo.Context) error {
@@ -195,10 +395,6 @@ func webhookBuild(c echo.Context) error {
 	if err := json.Unmarshal(RawBody, &body); err != nil {
 		return err
 	}
-	b, err := build.New(cfgFile)
-	if err != nil {
-		return err
-	}
 
 	if gst == vars.GSPGitHub {
 		if err := checkGitHubWebhook(c, opt, RawBody); err != nil {
@@ -234,8 +430,15 @@ func webhookBuild(c echo.Context) error {
 		return c.JSON(200, resb{res{false, "excluded branch"}, branch})
 	}
 
-	go b.BuildWithLog(name, branch, vars.WebhookSender)
-	return c.JSON(201, resb{res{Success: true}, branch})
+	t, err := builder.NewTask(name, branch, vars.WebhookSender)
+	if err != nil {
+		return err
+	}
+	t, err = builder.Enqueue(t)
+	if err != nil {
+		return err
+	}
+	return c.JSON(201, resq{resb{res{Success: true}, t.Branch}, t.ID})
 }
 
 func apiBadge(c echo.Context) error {
@@ -245,12 +448,25 @@ func apiBadge(c echo.Context) error {
 
 	name := c.Param("name")
 	branch := strings.ToLower(getArg(c, "branch"))
+	commit := getArg(c, "commit")
 	status := ""
 
 	if !pm.HasName(name) {
 		return badgeRes(c, unknown)
 	}
 
+	// 指定提交时显示该提交最近一次构建的结果
+	if commit != "" {
+		rst, err := pm.GetBuildByCommit(name, commit)
+		if err != nil {
+			return badgeRes(c, unknown)
+		}
+		if rst.Status {
+			return badgeRes(c, passing)
+		}
+		return badgeRes(c, failing)
+	}
+
 	if branch == "" || branch == "latest" {
 		opt, err := pm.GetName(name)
 		if err != nil {
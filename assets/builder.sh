@@ -9,6 +9,47 @@
 
 readonly rtfd_cmd="rtfd"
 rtfd_cfg="${RTFD_CFG:-$HOME/.rtfd.cfg}"
+#: 状态文件，每行一条JSON格式的步骤事件，供rtfd判断构建结果
+status_file=""
+current_step=""
+
+_status() {
+    #: 写入步骤事件，用法：_status <step> <event> [key value]...
+    [ -z "$status_file" ] && return 0
+    local step=$1
+    local event=$2
+    shift 2
+    local extra=""
+    while [ $# -gt 1 ]; do
+        extra="${extra},\"$1\":\"$2\""
+        shift 2
+    done
+    echo "{\"step\":\"${step}\",\"event\":\"${event}\",\"time\":$(date +%s)${extra}}" >>$status_file
+}
+
+_jsonEscape() {
+    #: 转义JSON字符串中的反斜杠与双引号，制表符替换为空格
+    local s=${1//\\/\\\\}
+    s=${s//\"/\\\"}
+    echo "${s//$'\t'/ }"
+}
+
+_stepStart() {
+    current_step=$1
+    _status $1 start
+}
+
+_stepEnd() {
+    _status $1 end
+    current_step=""
+}
+
+_onExit() {
+    local code=$?
+    if [ $code -ne 0 ]; then
+        _status "${current_step:-init}" fail code $code
+    fi
+}
 
 checkExitParam() {
     local n=$1
@@ -67,6 +108,35 @@ _debugp() {
     fi
 }
 
+_symlink() {
+    #: 先创建临时链接再重命名覆盖，原子地将 $2 指向 $1，访问者不会看到链接缺失
+    local target=$1
+    local link=$2
+    local tmp="$(dirname $link)/.$(basename $link).tmp-$3"
+    ln -snf $target $tmp || return 1
+    mv -T $tmp $link || { rm -f $tmp; return 1; }
+}
+
+_publish() {
+    #: 将暂存目录以符号链接原子地发布为 <lang>/<branch>，并清理旧的暂存目录
+    local lang_dir=$1
+    local branch=$2
+    local build_id=$3
+    local target=$(_joinPath $lang_dir .builds/${branch}/${build_id})
+    local link=$(_joinPath $lang_dir $branch)
+    mkdir -p $(dirname $link)
+    if [[ -d $link && ! -L $link ]]; then
+        local legacy=$(_joinPath $lang_dir .builds/${branch}/legacy)
+        rm -rf $legacy
+        mv $link $legacy || return 1
+    fi
+    _symlink $target $link $build_id || return 1
+    for d in $(dirname $target)/*; do
+        [ "$d" != "$target" ] && rm -rf $d
+    done
+    return 0
+}
+
 _envManager() {
     #: 切换到项目中，创建虚拟环境并构建文档
     local project_name=$1
@@ -74,20 +144,12 @@ _envManager() {
     local project_runtime_dir=$3
     local project_docs_dir=$4
 
-    local py2_path=$(_getRtfdConf py py2)
-    local py3_path=$(_getRtfdConf py py3)
     local rtfd_server=$(_getRtfdConf api server_url)
     local server_static_url=$(_getRtfdConf api server_static_url ${rtfd_server}/rtfd/assets/)
     local favicon_url=$(_getRtfdConf default favicon_url https://static.saintic.com/rtfd/favicon.png)
     local default_index=$(_getRtfdConf py index https://pypi.org/simple)
 
     #: 校验参数
-    checkExitParam _envManager_py2_path $py2_path
-    checkExitParam _envManager_py3_path $py3_path
-    which $py2_path &>/dev/null
-    checkExitRetcode
-    which $py3_path &>/dev/null
-    checkExitRetcode
     checkExitParam _envManager_project_runtime_dir $project_runtime_dir
     checkExitParam _envManager_project_docs_dir $project_docs_dir
     checkExitParam _envManager_branch $branch
@@ -124,20 +186,22 @@ _envManager() {
         echo "In rtfd.ini, sourcedir cannot start with / or .."
         exit 1
     fi
+    #: Python版本即[py]配置段中声明的名称，2、3 对应 py2、py3
     case $py_version in
-    2)
-        local py_path=$py2_path
-        ;;
-    3)
-        local py_path=$py3_path
+    2 | 3)
+        local py_path=$(_getRtfdConf py py${py_version})
         ;;
     *)
-        local py_path=$py3_path
+        local py_path=$(_getRtfdConf py ${py_version})
         ;;
     esac
+    checkExitParam _envManager_py_path $py_path
+    which $py_path &>/dev/null
+    checkExitRetcode
     local vd="venv-${py_version}"
     local venv="${py_path} -m virtualenv"
     #: 创建虚拟环境
+    _stepStart venv
     if [ ! -d $vd ]; then
         $venv $vd
         checkExitRetcode
@@ -145,7 +209,9 @@ _envManager() {
     #: 激活虚拟环境
     source ${vd}/bin/activate
     checkExitRetcode
+    _stepEnd venv
     #: 安装依赖（必须自行将sphinx写入依赖包文件）
+    _stepStart pip
     local venv_py=$(_joinPath $project_runtime_dir ${vd}/bin/python)
     local venv_pip_install="${venv_py} -m pip install -i ${py_index}"
     for req in ${py_requirements//,/ }; do
@@ -156,7 +222,9 @@ _envManager() {
         $venv_pip_install .
         checkExitRetcode
     fi
+    _stepEnd pip
     #: 更新conf.py
+    _stepStart sphinx
     local sphinx_conf=$(_joinPath $sphinx_sourcedir conf.py)
     if [ ! -f $sphinx_conf ]; then
         echo "Not found docs conf.py in $(_joinPath $project_runtime_dir $sphinx_sourcedir)"
@@ -174,18 +242,34 @@ EOF
     local before_hook=$(_getDocsConf $project_name BeforeHook)
     if [ ! -z "$before_hook" ]; then
         _debugp "Trigger before_hook: ${before_hook}"
+        _stepStart hook
         ($before_hook)
         checkExitRetcode
+        _stepEnd hook
+        _stepStart sphinx
     fi
-    #: 构建
+    #: 构建：先输出到暂存目录，全部语言构建成功后再发布，失败则保留原有版本
     local sphinx_build=$(_joinPath $project_runtime_dir ${vd}/bin/sphinx-build)
+    local build_id=$(basename $build_runtime_dir)
     for lang in ${sphinx_languages//,/ }; do
         local project_docs_lang_dir=$(_joinPath ${project_docs_dir} ${lang})
-        $sphinx_build -E -T -D language=${lang} -b ${sphinx_builder} $sphinx_sourcedir $(_joinPath ${project_docs_lang_dir} ${branch})
+        $sphinx_build -E -T -D language=${lang} -b ${sphinx_builder} $sphinx_sourcedir $(_joinPath ${project_docs_lang_dir} .builds/${branch}/${build_id})
+        if [ $? -ne 0 ]; then
+            for l in ${sphinx_languages//,/ }; do
+                rm -rf $(_joinPath ${project_docs_dir} ${l}/.builds/${branch}/${build_id})
+            done
+            false
+            checkExitRetcode
+        fi
+    done
+    for lang in ${sphinx_languages//,/ }; do
+        local project_docs_lang_dir=$(_joinPath ${project_docs_dir} ${lang})
+        _publish $project_docs_lang_dir $branch $build_id
         checkExitRetcode
-        ln -nsf $(_joinPath ${project_docs_lang_dir} ${project_latest}) $(_joinPath ${project_docs_lang_dir} latest)
+        _symlink $(_joinPath ${project_docs_lang_dir} ${project_latest}) $(_joinPath ${project_docs_lang_dir} latest) $build_id
         checkExitRetcode
     done
+    _stepEnd sphinx
     #: 执行构建成功后的钩子命令：
     local after_hook=$(_getDocsConf $project_name AfterHook)
     if [ ! -z "$after_hook" ]; then
@@ -214,10 +298,18 @@ _codeManager() {
     cd $runtime_dir
     checkExitRetcode
     [ -d $project_name ] && rm -rf $project_name
+    _stepStart clone
     git clone --branch $branch --single-branch --depth=1 --recursive $project_git $project_name
     checkExitRetcode
     cd $project_name
     checkExitRetcode
+    local commit=$(git rev-parse HEAD)
+    echo "Checkout commit ${commit}"
+    _status clone commit sha ${commit} \
+        author "$(_jsonEscape "$(git log -1 --format=%an)")" \
+        date "$(git log -1 --format=%cI)" \
+        subject "$(_jsonEscape "$(git log -1 --format=%s)")"
+    _stepEnd clone
 }
 
 usage() {
@@ -230,6 +322,8 @@ Options:
     -n, --name    The docs project name
     -b, --branch  The docs project branch, default is master.
     -c, --config  The config file, default is ${rtfd_cfg}
+    -r, --runtime The runtime directory, default is a temporary directory in base_dir/runtimes
+    -s, --status  The status file, step events are appended to it in JSON lines
 "
     return $?
 }
@@ -258,6 +352,16 @@ main() {
             rtfd_cfg="${config:=$rtfd_cfg}"
             shift
             ;;
+        -r | --runtime)
+            local runtime="${2}"
+            checkExitParam runtime $runtime
+            shift
+            ;;
+        -s | --status)
+            status_file="${2}"
+            checkExitParam status_file $status_file
+            shift
+            ;;
         -h | --help | \?)
             usage
             exit 0
@@ -297,7 +401,13 @@ main() {
     local runtimes_dir=$(_joinPath $base_dir runtimes)
     [ -d $docs_dir ] || mkdir -p $docs_dir
     [ -d $runtimes_dir ] || mkdir -p $runtimes_dir
-    local runtimes_dir=$(mktemp -d -p $runtimes_dir)
+    if [ -n "$runtime" ]; then
+        local runtimes_dir=$runtime
+        [ -d $runtimes_dir ] || mkdir -p $runtimes_dir
+    else
+        local runtimes_dir=$(mktemp -d -p $runtimes_dir)
+    fi
+    build_runtime_dir=$runtimes_dir
 
     _codeManager $project_name $branch $runtimes_dir
     checkExitRetcode
@@ -308,6 +418,7 @@ main() {
     checkExitRetcode
 
     local utime=$(($SECONDS - $stime))
+    _status done end usedtime $utime
     echo "Build Successfully, $utime seconds passed."
     rm -rf $runtimes_dir
     exit 0
@@ -315,9 +426,14 @@ main() {
 
 Clean() {
     echo "The program was terminated, will exit!"
+    trap - SIGINT SIGTERM
+    [ -n "$build_runtime_dir" ] && rm -rf $build_runtime_dir
+    #: 终止同进程组内的子进程（如 sphinx-build）
+    kill -- -$$ 2>/dev/null
     exit 1
 }
 
 trap 'Clean; exit' SIGINT SIGTERM
+trap '_onExit' EXIT
 
 main "$@"
@@ -182,6 +182,34 @@ var _rtfd_script =
             head.appendChild(style)
         }
 
+        //The commit which the current version was built from
+        function builtFrom(data, branch) {
+            let ver = branch === 'latest' ? data.latest : branch
+            let built = data.builds ? data.builds[ver] : null
+            if (!built || !built.commit) {
+                return ''
+            }
+            return `<span>Built from ${built.commit.slice(0, 7)}</span><br>`
+        }
+
+        //Download links of the current version
+        function downloads(data, lang, branch) {
+            let ver = branch === 'latest' ? data.latest : branch
+            let files = data.downloads && data.downloads[lang] ? data.downloads[lang][ver] : null
+            if (!files) {
+                return ''
+            }
+            let dds = ['pdf', 'epub', 'htmlzip']
+                .filter(function (format) {
+                    return files[format]
+                })
+                .map(function (format) {
+                    return `<dd><a href="${files[format]}">${format}</a></dd>`
+                })
+                .join('')
+            return dds ? `<dl><dt>Downloads</dt>${dds}</dl>` : ''
+        }
+
         //Initiate an ajax request to get the initialization code of the document
         function init() {
             let name = getUrlQuery('name')
@@ -234,7 +262,7 @@ var _rtfd_script =
                             if (res.data.hideGit === true) {
                                 github_str = ''
                             }
-                            base_str = `<div id="rtfd" class="rtfd"><div id="rtfd-header"><img src="${icon_baseuri}"><scan>&nbsp;v: ${branch}&nbsp;</scan></div><div id="rtfd-body"><dl><dt>Languages</dt>${langs_str}</dl><dl><dt>Versions</dt>${vers_str}</dl><dl><dt>On ${res.data.gsp}</dt>${github_str}</dl><hr><small class="footer"><span>Powered by <a href="https://github.com/staugur/rtfd">rtfd</a></span></small></div></div>`
+                            base_str = `<div id="rtfd" class="rtfd"><div id="rtfd-header"><img src="${icon_baseuri}"><scan>&nbsp;v: ${branch}&nbsp;</scan></div><div id="rtfd-body"><dl><dt>Languages</dt>${langs_str}</dl><dl><dt>Versions</dt>${vers_str}</dl>${downloads(res.data, lang, branch)}<dl><dt>On ${res.data.gsp}</dt>${github_str}</dl><hr><small class="footer">${builtFrom(res.data, branch)}<span>Powered by <a href="https://github.com/staugur/rtfd">rtfd</a></span></small></div></div>`
                         } else {
                             branch = 'latest'
                             let other_path = location.pathname
@@ -250,7 +278,7 @@ var _rtfd_script =
                             if (res.data.hideGit === true) {
                                 github_str = ''
                             }
-                            base_str = `<div id="rtfd" class="rtfd"><div id="rtfd-header"><img src="${icon_baseuri}"><scan>&nbsp;v: ${branch}&nbsp;</scan></div><div id="rtfd-body"><dl><dt>On ${res.data.gsp}</dt>${github_str}</dl><hr><small class="footer"><span>Powered by <a href="https://github.com/staugur/rtfd">rtfd</a></span></small></div></div>`
+                            base_str = `<div id="rtfd" class="rtfd"><div id="rtfd-header"><img src="${icon_baseuri}"><scan>&nbsp;v: ${branch}&nbsp;</scan></div><div id="rtfd-body">${downloads(res.data, res.data.lang[0], branch)}<dl><dt>On ${res.data.gsp}</dt>${github_str}</dl><hr><small class="footer">${builtFrom(res.data, branch)}<span>Powered by <a href="https://github.com/staugur/rtfd">rtfd</a></span></small></div></div>`
                         }
                         addCSS(
                             'https://static.saintic.com/rtfd/tipped/tipped.css'
@@ -264,6 +292,9 @@ var _rtfd_script =
                                         `Version: ${branch}` +
                                         (branch === 'latest'
                                             ? ' -> ' + res.data.latest
+                                            : branch === 'stable' &&
+                                              res.data.stable
+                                            ? ' -> ' + res.data.stable
                                             : ''),
                                     inline: 'rtfd-body',
                                     showOn: 'click',
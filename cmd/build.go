@@ -18,8 +18,12 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
 
 	"pkg/tcw.im/rtfd/pkg/build"
+	"pkg/tcw.im/rtfd/pkg/lib"
 	"pkg/tcw.im/rtfd/vars"
 
 	"github.com/spf13/cobra"
@@ -29,13 +33,24 @@ import (
 var buildCmd = &cobra.Command{
 	Use:   "build",
 	Short: "构建文档",
-	Args:  cobra.ExactArgs(1),
+	Long: `构建文档，默认构建项目 latest 所指向的分支
+
+使用 --all-branches、--tags、--match 时从远程仓库列出符合条件的分支与标签，
+逐个加入构建队列，由worker构建，全部结束后输出构建结果汇总，如：
+
+  rtfd build <name> --tags 'v*'`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		name := args[0]
 		branch := cmd.Flag("branch").Value.String()
 		flagset := cmd.Flags()
 		isDebug, _ := flagset.GetBool("debug")
 		isLog, _ := flagset.GetBool("log")
+		force, _ := flagset.GetBool("force")
+		allBranches, _ := flagset.GetBool("all-branches")
+		tags, _ := flagset.GetString("tags")
+		match, _ := flagset.GetString("match")
+		f := build.RefFilter{AllBranches: allBranches, Tags: tags, Match: match}
 
 		b, err := build.New(cfgFile)
 		if err != nil {
@@ -43,24 +58,134 @@ var buildCmd = &cobra.Command{
 			return
 		}
 
-		if isDebug && isLog {
-			err = b.BuildWithAll(name, branch, vars.CLISender)
-		} else if isDebug {
-			err = b.BuildWithDebug(name, branch, vars.CLISender)
-		} else if isLog {
-			err = b.BuildWithLog(name, branch, vars.CLISender)
-		} else {
-			err = b.Build(name, branch, vars.CLISender)
+		if !f.IsEmpty() {
+			if branch != "" {
+				fmt.Println("--branch cannot be used with --all-branches, --tags or --match")
+				os.Exit(1)
+			}
+			buildRefs(b, name, f, force)
+			return
+		}
+
+		t, err := b.NewTask(name, branch, vars.CLISender)
+		if err != nil {
+			fmt.Println(err)
+			return
 		}
+		t.Force = force
+		err = b.RunTask(t, isDebug, isLog)
 		if err != nil {
 			fmt.Println(err)
 		}
+		b.WaitNotify()
 	},
 }
 
+// buildRefs 将符合条件的分支与标签逐个加入构建队列，由worker构建，
+// 全部构建结束后输出汇总表格，有构建未成功时以非零状态退出
+func buildRefs(b *build.Builder, name string, f build.RefFilter, force bool) {
+	pm, err := lib.New(cfgFile)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(127)
+	}
+	refs, err := b.MatchRefs(name, f)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(128)
+	}
+	if len(refs) == 0 {
+		fmt.Println("no matching branches or tags")
+		return
+	}
+
+	tasks := make([]*build.Task, 0, len(refs))
+	for i, ref := range refs {
+		t, err := b.NewTask(name, ref, vars.CLISender)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(129)
+		}
+		t.Force = force
+		t, err = b.Enqueue(t)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(129)
+		}
+		fmt.Printf("==> [%d/%d] queued %s %s (%s)\n", i+1, len(refs), name, t.Branch, t.ID)
+		tasks = append(tasks, t)
+	}
+
+	// 等待全部构建结束，没有存活的worker时不再等待
+	timeout := time.Duration(pm.CFG().MustInt("build", "worker_timeout", 30)) * time.Second
+	for !buildsDone(pm, name, tasks) {
+		if !hasWorker(pm, timeout) {
+			fmt.Println("no running worker, the remaining builds stay in the queue (start one with `rtfd worker`)")
+			break
+		}
+		time.Sleep(refsPollInterval)
+	}
+
+	failed := false
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nREF\tSTATE\tCOMMIT\tUSEDTIME\tID")
+	for _, t := range tasks {
+		state, commit, usedtime := "pending", "", ""
+		if rst, err := pm.GetBuildByID(name, t.ID); err == nil {
+			state, commit = string(rst.State), rst.Commit
+			if len(commit) > 7 {
+				commit = commit[:7]
+			}
+			if rst.Usedtime >= 0 {
+				usedtime = fmt.Sprintf("%ds", rst.Usedtime)
+			}
+		}
+		if state != string(lib.StatePassing) && state != string(lib.StateSkipped) {
+			failed = true
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.Branch, state, commit, usedtime, t.ID)
+	}
+	w.Flush()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// refsPollInterval 等待队列中构建结束时查询构建记录的间隔
+const refsPollInterval = 2 * time.Second
+
+// buildsDone 任务是否都已构建结束（已开始构建且不在运行中）
+func buildsDone(pm *lib.ProjectManager, name string, tasks []*build.Task) bool {
+	for _, t := range tasks {
+		rst, err := pm.GetBuildByID(name, t.ID)
+		if err != nil || rst.State == lib.StateRunning {
+			return false
+		}
+	}
+	return true
+}
+
+// hasWorker 是否有在 timeout 内发送过心跳的worker
+func hasWorker(pm *lib.ProjectManager, timeout time.Duration) bool {
+	beats, err := pm.Workers()
+	if err != nil {
+		return true
+	}
+	for _, beat := range beats {
+		if time.Since(beat) <= timeout {
+			return true
+		}
+	}
+	return false
+}
+
 func init() {
 	rootCmd.AddCommand(buildCmd)
 	buildCmd.Flags().StringP("branch", "b", "", "分支或标签")
 	buildCmd.Flags().BoolP("debug", "", false, "使用调试模式运行构建")
 	buildCmd.Flags().BoolP("log", "", false, "日志记录构建输出")
+	buildCmd.Flags().BoolP("force", "f", false, "强制构建，即使提交与最近一次成功构建相同")
+	buildCmd.Flags().BoolP("all-branches", "", false, "构建远程仓库的全部分支")
+	buildCmd.Flags().StringP("tags", "", "", "构建名称匹配的标签，如 'v*'")
+	buildCmd.Flags().StringP("match", "", "", "构建名称匹配的分支或标签，glob模式")
 }
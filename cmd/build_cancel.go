@@ -0,0 +1,56 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"pkg/tcw.im/rtfd/pkg/build"
+
+	"github.com/spf13/cobra"
+)
+
+// cancelCmd represents the build cancel command
+var cancelCmd = &cobra.Command{
+	Use:   "cancel",
+	Short: "取消正在运行的构建",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id := args[0]
+		if id == "" {
+			fmt.Println("invalid build id")
+			os.Exit(1)
+		}
+
+		b, err := build.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+		err = b.Cancel(id)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(128)
+		}
+		fmt.Println("cancelled")
+	},
+}
+
+func init() {
+	buildCmd.AddCommand(cancelCmd)
+}
@@ -0,0 +1,64 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+
+	"github.com/spf13/cobra"
+)
+
+// envListCmd represents the project env list command
+var envListCmd = &cobra.Command{
+	Use:   "list <name>",
+	Short: "列出构建环境变量，默认不显示变量值",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		show, _ := cmd.Flags().GetBool("show-values")
+
+		pm, err := lib.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+		if !pm.HasName(args[0]) {
+			fmt.Println("not found project")
+			os.Exit(128)
+		}
+		env, err := pm.GetEnv(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(129)
+		}
+		if !show {
+			for k := range env {
+				env[k] = "***"
+			}
+		}
+		for _, kv := range lib.EnvList(env) {
+			fmt.Println(kv)
+		}
+	},
+}
+
+func init() {
+	envCmd.AddCommand(envListCmd)
+	envListCmd.Flags().BoolP("show-values", "", false, "显示解密后的变量值")
+}
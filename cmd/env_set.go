@@ -0,0 +1,67 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+
+	"github.com/spf13/cobra"
+)
+
+// envSetCmd represents the project env set command
+var envSetCmd = &cobra.Command{
+	Use:   "set <name> KEY=VALUE...",
+	Short: "设置构建环境变量",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		env := make(map[string]string)
+		for _, kv := range args[1:] {
+			kvs := strings.SplitN(kv, "=", 2)
+			if len(kvs) != 2 {
+				fmt.Printf("invalid %s\n", kv)
+				os.Exit(1)
+			}
+			if err := lib.CheckEnvName(kvs[0]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			env[kvs[0]] = kvs[1]
+		}
+
+		pm, err := lib.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+		for k, v := range env {
+			if err := pm.SetEnv(name, k, v); err != nil {
+				fmt.Println(err)
+				os.Exit(128)
+			}
+		}
+		fmt.Println("updated")
+	},
+}
+
+func init() {
+	envCmd.AddCommand(envSetCmd)
+}
@@ -0,0 +1,54 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+
+	"github.com/spf13/cobra"
+)
+
+// envUnsetCmd represents the project env unset command
+var envUnsetCmd = &cobra.Command{
+	Use:   "unset <name> KEY...",
+	Short: "删除构建环境变量",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		pm, err := lib.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+		if !pm.HasName(args[0]) {
+			fmt.Println("not found project")
+			os.Exit(128)
+		}
+		err = pm.UnsetEnv(args[0], args[1:]...)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(129)
+		}
+		fmt.Println("updated")
+	},
+}
+
+func init() {
+	envCmd.AddCommand(envUnsetCmd)
+}
@@ -0,0 +1,84 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+
+	"github.com/spf13/cobra"
+	"pkg.tcw.im/gtc"
+)
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "查看文档项目的构建日志",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		if name == "" {
+			fmt.Println("invalid name")
+			os.Exit(1)
+		}
+		branch := cmd.Flag("branch").Value.String()
+		id := cmd.Flag("id").Value.String()
+
+		pm, err := lib.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+
+		var rst lib.Result
+		if id != "" {
+			rst, err = pm.GetBuildByID(name, id)
+		} else {
+			if branch == "" {
+				opt, err := pm.GetName(name)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(128)
+				}
+				branch = opt.Latest
+			}
+			rst, err = pm.GetBuildset(name, branch)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(128)
+		}
+		if rst.Log == "" || !gtc.IsFile(rst.Log) {
+			fmt.Println("not found build log")
+			os.Exit(129)
+		}
+		text, err := os.ReadFile(rst.Log)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(129)
+		}
+		fmt.Print(string(text))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.Flags().StringP("branch", "b", "", "分支或标签，默认是latest所指向的分支")
+	logsCmd.Flags().StringP("id", "", "", "构建ID，优先级高于branch")
+}
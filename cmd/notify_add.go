@@ -0,0 +1,70 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+
+	"github.com/spf13/cobra"
+)
+
+// notifyAddCmd represents the project notify add command
+var notifyAddCmd = &cobra.Command{
+	Use:   "add <name> <id>",
+	Short: "添加或更新通知目标",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		name, id := args[0], args[1]
+		t := lib.NotifyTarget{
+			ID:     id,
+			Type:   lib.NotifyType(strings.ToLower(cmd.Flag("type").Value.String())),
+			URL:    cmd.Flag("url").Value.String(),
+			Secret: cmd.Flag("secret").Value.String(),
+			To:     cmd.Flag("to").Value.String(),
+			On:     cmd.Flag("on").Value.String(),
+		}
+		if err := t.Check(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		pm, err := lib.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+		err = pm.AddNotify(name, t)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(128)
+		}
+		fmt.Println("added")
+	},
+}
+
+func init() {
+	notifyCmd.AddCommand(notifyAddCmd)
+	notifyAddCmd.Flags().StringP("type", "t", "webhook", "目标类型：webhook、slack、smtp")
+	notifyAddCmd.Flags().StringP("url", "u", "", "webhook、slack 的地址")
+	notifyAddCmd.Flags().StringP("secret", "", "", "webhook 签名密钥")
+	notifyAddCmd.Flags().StringP("to", "", "", "smtp 收件人，以英文逗号分隔多个")
+	notifyAddCmd.Flags().StringP("on", "", "failure,recovery", "触发事件：failure、recovery、success、always，以英文逗号分隔")
+}
@@ -0,0 +1,57 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+
+	"github.com/spf13/cobra"
+)
+
+// notifyListCmd represents the project notify list command
+var notifyListCmd = &cobra.Command{
+	Use:   "list <name>",
+	Short: "列出通知目标（不显示签名密钥）",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		pm, err := lib.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+		targets, err := pm.ListNotify(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(128)
+		}
+		for i := range targets {
+			if targets[i].Secret != "" {
+				targets[i].Secret = "***"
+			}
+		}
+		data, _ := json.Marshal(targets)
+		fmt.Println(string(data))
+	},
+}
+
+func init() {
+	notifyCmd.AddCommand(notifyListCmd)
+}
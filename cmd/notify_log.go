@@ -0,0 +1,59 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+
+	"github.com/spf13/cobra"
+)
+
+// notifyLogCmd represents the project notify log command
+var notifyLogCmd = &cobra.Command{
+	Use:   "log <name>",
+	Short: "显示最近的通知投递记录",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		limit, err := cmd.Flags().GetInt("limit")
+		if err != nil {
+			fmt.Printf("invalid param(limit): %v\n", limit)
+			os.Exit(1)
+		}
+
+		pm, err := lib.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+		ds, err := pm.ListDelivery(args[0], limit)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(128)
+		}
+		data, _ := json.Marshal(ds)
+		fmt.Println(string(data))
+	},
+}
+
+func init() {
+	notifyCmd.AddCommand(notifyLogCmd)
+	notifyLogCmd.Flags().IntP("limit", "l", 20, "显示条数")
+}
@@ -0,0 +1,78 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+
+	"github.com/spf13/cobra"
+)
+
+// buildsCmd represents the builds command
+var buildsCmd = &cobra.Command{
+	Use:     "builds",
+	Short:   "分页显示文档项目的构建历史",
+	Args:    cobra.ExactArgs(1),
+	Aliases: []string{"b"},
+	Run: func(cmd *cobra.Command, args []string) {
+		flagset := cmd.Flags()
+
+		name := args[0]
+		if name == "" {
+			fmt.Println("invalid name")
+			os.Exit(1)
+		}
+		page, err := flagset.GetInt("page")
+		if err != nil {
+			fmt.Printf("invalid param(page): %v\n", page)
+			os.Exit(1)
+		}
+		limit, err := flagset.GetInt("limit")
+		if err != nil {
+			fmt.Printf("invalid param(limit): %v\n", limit)
+			os.Exit(1)
+		}
+
+		pm, err := lib.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+		if !pm.HasName(name) {
+			fmt.Println("not found project")
+			os.Exit(128)
+		}
+
+		h, err := pm.ListHistory(name, page, limit)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(129)
+		}
+		data, _ := json.Marshal(h)
+		fmt.Println(string(data))
+	},
+}
+
+func init() {
+	projectCmd.AddCommand(buildsCmd)
+	buildsCmd.Flags().IntP("page", "p", 1, "页码")
+	buildsCmd.Flags().IntP("limit", "l", 20, "每页条数")
+}
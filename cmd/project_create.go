@@ -53,7 +53,7 @@ var createCmd = &cobra.Command{
 		}
 		source := cmd.Flag("sourcedir").Value.String()
 		lang := cmd.Flag("lang").Value.String()
-		pyver, err := flagset.GetUint8("version")
+		pyver, err := flagset.GetString("version")
 		if err != nil {
 			fmt.Printf("invalid param(version): %v\n", pyver)
 			fmt.Println(err)
@@ -72,8 +72,37 @@ var createCmd = &cobra.Command{
 		sslcrt := cmd.Flag("sslcrt").Value.String()
 		sslkey := cmd.Flag("sslkey").Value.String()
 		builder := cmd.Flag("builder").Value.String()
+		engine := cmd.Flag("engine").Value.String()
+		inject := cmd.Flag("inject").Value.String()
+		formats := cmd.Flag("formats").Value.String()
+		command := cmd.Flag("command").Value.String()
+		output := cmd.Flag("output").Value.String()
 		before := cmd.Flag("before").Value.String()
 		after := cmd.Flag("after").Value.String()
+		schedule := cmd.Flag("schedule").Value.String()
+		failOnWarning, _ := flagset.GetBool("fail-on-warning")
+		keep, err := flagset.GetInt("keep-builds")
+		if err != nil {
+			fmt.Printf("invalid param(keep-builds): %v\n", keep)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		timeout, err := flagset.GetInt("timeout")
+		if err != nil {
+			fmt.Printf("invalid param(timeout): %v\n", timeout)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		keepTags, err := flagset.GetInt("keep-tags")
+		if err != nil || keepTags < 0 {
+			fmt.Printf("invalid param(keep-tags): %v\n", keepTags)
+			os.Exit(1)
+		}
+		branchMaxAge, err := flagset.GetInt("branch-max-age")
+		if err != nil || branchMaxAge < 0 {
+			fmt.Printf("invalid param(branch-max-age): %v\n", branchMaxAge)
+			os.Exit(1)
+		}
 
 		pm, err := lib.New(cfgFile)
 		if err != nil {
@@ -111,8 +140,19 @@ var createCmd = &cobra.Command{
 		optBind["SSLPublic"] = sslcrt
 		optBind["SSLPrivate"] = sslkey
 		optBind["Builder"] = builder
+		optBind["Engine"] = engine
+		optBind["Inject"] = inject
+		optBind["Formats"] = formats
+		optBind["Command"] = command
+		optBind["OutputDir"] = output
 		optBind["BeforeHook"] = before
 		optBind["AfterHook"] = after
+		optBind["KeepBuilds"] = keep
+		optBind["Timeout"] = timeout
+		optBind["Schedule"] = schedule
+		optBind["KeepTags"] = keepTags
+		optBind["BranchMaxAge"] = branchMaxAge
+		optBind["FailOnWarning"] = failOnWarning
 
 		for k, v := range optBind {
 			pm.SetOption(&opt, k, v)
@@ -135,15 +175,26 @@ func init() {
 	createCmd.Flags().BoolP("single", "", false, "是否为单一版本")
 	createCmd.Flags().StringP("sourcedir", "s", "docs", "实际文档文件所在目录，目录路径是项目的相对位置")
 	createCmd.Flags().StringP("lang", "l", "en", "文档语言，支持多种，以英文逗号分隔")
-	createCmd.Flags().Uint8P("version", "v", 3, "构建文档所用的Python版本，2或3")
+	createCmd.Flags().StringP("version", "v", "3", "构建文档所用的Python版本，即系统配置py分区中声明的名称，如2、3、3.8")
 	createCmd.Flags().StringP("requirement", "r", "", "需要安装的依赖包需求文件（文件路径是项目的相对位置），支持多个，以英文逗号分隔")
 	createCmd.Flags().BoolP("install", "", false, "是否需要安装项目")
 	createCmd.Flags().StringP("index", "i", "", "指定pip安装时的pypi源")
-	createCmd.Flags().StringP("builder", "b", "html", "Sphinx构建器，可选html、dirhtml、singlehtml")
+	createCmd.Flags().StringP("engine", "e", "sphinx", "文档引擎，可选sphinx、mkdocs")
+	createCmd.Flags().StringP("builder", "b", "html", "Sphinx构建器，可选html、dirhtml、singlehtml，custom表示使用自定义命令构建")
+	createCmd.Flags().StringP("formats", "", "", "额外构建的下载格式（仅Sphinx），可选pdf、epub、htmlzip，以英文逗号分隔")
+	createCmd.Flags().BoolP("fail-on-warning", "", false, "Sphinx构建有警告时视为构建失败")
+	createCmd.Flags().StringP("inject", "", "html", "rtfd.js与favicon的注入方式：html为构建后插入HTML文件，conf为写入文档配置，none为不注入")
+	createCmd.Flags().StringP("command", "", "", "自定义构建器的构建命令，如 hugo --minify、npm ci && npm run build")
+	createCmd.Flags().StringP("output", "", "", "自定义构建器的输出目录（项目的相对位置），如 public、build")
 	createCmd.Flags().StringP("secret", "", "", "Api/Webhook密钥")
 	createCmd.Flags().StringP("domain", "", "", "自定义域名")
 	createCmd.Flags().StringP("sslcrt", "", "", "自定义域名的SSL证书公钥")
 	createCmd.Flags().StringP("sslkey", "", "", "自定义域名的SSL证书私钥")
 	createCmd.Flags().StringP("before", "", "", "构建前的钩子命令")
 	createCmd.Flags().StringP("after", "", "", "执行构建成功后的钩子命令")
+	createCmd.Flags().IntP("keep-builds", "", 0, "保留的构建历史条数，默认由配置文件指定")
+	createCmd.Flags().IntP("timeout", "", 0, "构建超时时间（秒），默认由配置文件指定")
+	createCmd.Flags().IntP("keep-tags", "", 0, "保留的标签（语义化版本号）文档版本数，按版本号保留最新的，默认不限制")
+	createCmd.Flags().IntP("branch-max-age", "", 0, "分支文档版本最近一次构建超过此天数即删除，默认不限制")
+	createCmd.Flags().StringP("schedule", "", "", "定时构建latest分支的cron表达式（分 时 日 月 周），如 '0 3 * * *'")
 }
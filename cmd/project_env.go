@@ -0,0 +1,45 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var envDesc = `文档项目的构建环境变量管理
+
+环境变量加密保存（密钥为系统配置 build 分区的 env_key），仅在构建时导出到构建进程的环境中，
+构建日志中的变量值会被遮蔽，默认不包含在 get、transfer 的输出中。
+
+    $ rtfd p env set <NAME> PYPI_TOKEN=xxx API_KEY=yyy
+    $ rtfd p env unset <NAME> API_KEY
+    $ rtfd p env list <NAME>`
+
+// envCmd represents the project env command
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "文档项目的构建环境变量管理",
+	Long:  envDesc,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	projectCmd.AddCommand(envCmd)
+}
@@ -92,6 +92,22 @@ var getCmd = &cobra.Command{
 			}
 		}
 
+		// 构建环境变量仅在明确要求时输出
+		if withEnv, _ := flagset.GetBool("with-env"); withEnv {
+			env, err := pm.GetEnv(name)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(131)
+			}
+			var val map[string]interface{}
+			if err := json.Unmarshal(data, &val); err != nil {
+				fmt.Println(err)
+				os.Exit(131)
+			}
+			val["Env"] = env
+			data, _ = json.Marshal(val)
+		}
+
 		fmt.Println(string(data))
 	},
 }
@@ -99,4 +115,5 @@ var getCmd = &cobra.Command{
 func init() {
 	projectCmd.AddCommand(getCmd)
 	getCmd.Flags().BoolP("build", "b", false, "是否显示构建结果")
+	getCmd.Flags().BoolP("with-env", "", false, "是否显示（解密后的）构建环境变量")
 }
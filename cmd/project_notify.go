@@ -0,0 +1,60 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var notifyDesc = `文档项目的构建通知管理
+
+构建结束后向通知目标投递构建事件，投递失败时退避重试，并记录投递结果。
+
+目标类型（type）：
+
+    webhook：通用JSON webhook，设置 secret 时请求头 X-Rtfd-Signature 为
+             sha256=<请求体的HMAC-SHA256签名>，请求头 X-Rtfd-Event 为构建事件
+    slack：  Slack/Mattermost 风格的 incoming webhook
+    smtp：   邮件，需在系统配置 smtp 分区设置发信服务器
+
+触发事件（on，以逗号分隔多个，默认 failure,recovery）：
+
+    failure：构建失败或超时
+    recovery：构建由失败转为成功
+    success：构建成功
+    always：每次构建结束（跳过、取消的构建除外）
+
+    $ rtfd p notify add <NAME> ops --type slack --url https://hooks.slack.com/services/xxx
+    $ rtfd p notify add <NAME> mail --type smtp --to a@example.com --on always
+    $ rtfd p notify list <NAME>
+    $ rtfd p notify log <NAME>
+    $ rtfd p notify remove <NAME> ops`
+
+// notifyCmd represents the project notify command
+var notifyCmd = &cobra.Command{
+	Use:   "notify",
+	Short: "文档项目的构建通知管理",
+	Long:  notifyDesc,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	projectCmd.AddCommand(notifyCmd)
+}
@@ -0,0 +1,65 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"pkg/tcw.im/rtfd/pkg/build"
+
+	"github.com/spf13/cobra"
+)
+
+var pruneDryRun bool
+
+// pruneCmd represents the project prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune <name>",
+	Short: "按保留规则删除过期的文档版本",
+	Long: `按项目的保留规则（keeptags、branchmaxage）删除文档版本，
+包括各语言的文档目录、下载文件与构建结果，latest 所指向的版本不会被删除。`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := build.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+		pruned, err := b.Prune(args[0], pruneDryRun)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(128)
+		}
+		if len(pruned) == 0 {
+			fmt.Println("nothing to prune")
+			return
+		}
+		for _, v := range pruned {
+			if pruneDryRun {
+				fmt.Println("would prune", v)
+			} else {
+				fmt.Println("pruned", v)
+			}
+		}
+	},
+}
+
+func init() {
+	projectCmd.AddCommand(pruneCmd)
+	pruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "仅列出将被删除的版本")
+}
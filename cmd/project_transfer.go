@@ -48,6 +48,12 @@ var transferDesc = `转储（导入、导出）文档项目
     // Output: imported (if success)
 `
 
+// transferData 导出的项目数据，Env 为明文的构建环境变量（仅在要求时导出）
+type transferData struct {
+	lib.Options
+	Env map[string]string `json:",omitempty"`
+}
+
 // transferCmd represents the transfer command
 var transferCmd = &cobra.Command{
 	Use:     "transfer",
@@ -106,7 +112,16 @@ var transferCmd = &cobra.Command{
 					}
 				}
 			}
-			val, err := json.Marshal(opt)
+			data := transferData{Options: opt}
+			// 构建环境变量仅在明确要求时以明文导出
+			if ee, _ := flagset.GetBool("export-env"); ee {
+				data.Env, err = pm.GetEnv(name)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
+			val, err := json.Marshal(data)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -130,12 +145,13 @@ var transferCmd = &cobra.Command{
 			}
 
 			//ready to create a new project
-			var opt lib.Options
-			err = json.Unmarshal(IMjson, &opt)
+			var data transferData
+			err = json.Unmarshal(IMjson, &data)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(128)
 			}
+			opt := data.Options
 			name := opt.Name
 			if len(args) > 0 {
 				// override option Name
@@ -156,11 +172,24 @@ var transferCmd = &cobra.Command{
 			}
 			opt.DefaultDomain = name + "." + dn
 
+			// 先校验构建环境变量，避免项目创建后才失败
+			if err := pm.CheckEnv(data.Env); err != nil {
+				fmt.Println(err)
+				os.Exit(131)
+			}
 			err = pm.Create(name, opt)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(130)
 			}
+			for k, v := range data.Env {
+				if err := pm.SetEnv(name, k, v); err != nil {
+					// 不保留导入了一半的项目
+					pm.Remove(name)
+					fmt.Println(err)
+					os.Exit(131)
+				}
+			}
 			fmt.Println("imported")
 		}
 	},
@@ -170,6 +199,7 @@ func init() {
 	projectCmd.AddCommand(transferCmd)
 	transferCmd.Flags().BoolP("export", "e", false, "导出（格式为 base64 编码）项目")
 	transferCmd.Flags().BoolP("export-sys-meta", "", false, "是否导出Meta内置字段")
+	transferCmd.Flags().BoolP("export-env", "", false, "是否导出（明文的）构建环境变量")
 	transferCmd.Flags().StringP("import", "i", "", "导入（格式为 base64 编码）项目")
 	transferCmd.Flags().BoolP("import-debug", "d", false, "不导入项目，仅查看选项")
 }
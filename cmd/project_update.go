@@ -21,7 +21,6 @@ import (
 	"os"
 	"strings"
 
-	"pkg/tcw.im/rtfd/pkg/conf"
 	"pkg/tcw.im/rtfd/pkg/lib"
 	"pkg/tcw.im/rtfd/vars"
 
@@ -37,14 +36,20 @@ var updateDesc = `更新文档项目配置
 
     url：        文档项目的git仓库地址
     latest：     latest所指向的分支
-    version：    构建文档所用的Python版本，2或3（int）
+    version：    构建文档所用的Python版本，即系统配置py分区中声明的名称，如2、3、3.8
     single：     是否单一版本（bool）
     source：     文档源文件所在目录
     lang：       文档语言
     requirement：依赖包需求文件，支持多个，以逗号分隔
     install：    是否安装项目（bool）
     index：      pypi源
-    builder：    sphinx构建器
+    engine：     文档引擎，sphinx或mkdocs
+    builder：    sphinx构建器，custom表示使用自定义命令构建
+    inject：     rtfd.js与favicon的注入方式，html、conf或none
+    formats：    额外构建的下载格式，pdf、epub、htmlzip，多个以|分隔
+    failonwarning：Sphinx构建有警告时视为构建失败（bool）
+    command：    自定义构建器的构建命令
+    output：     自定义构建器的输出目录
     shownav：    是否显示导航（bool）
     hidegit：    导航中是否隐藏git信息（bool）
     secret：     api/webhook密钥
@@ -53,6 +58,11 @@ var updateDesc = `更新文档项目配置
     sslpri：     自定义域名开启HTTPS时的证书私钥
     before：     构建前的钩子命令
     after：      执行构建成功后的钩子命令
+    keepbuilds： 保留的构建历史条数，0表示使用系统配置（int）
+    timeout：    构建超时时间（秒），0表示使用系统配置（int）
+    schedule：   定时构建latest分支的cron表达式（分 时 日 月 周），如 0 3 * * *
+    keeptags：   保留的标签（语义化版本号）文档版本数，0表示不限制（int）
+    branchmaxage：分支文档版本最近一次构建超过此天数即删除，0表示不限制（int）
     meta：       额外配置数据，每次仅能更新一条，格式是 key=value（key不区分大小写）
 
     可一次更新一个或多个字段，格式是 -> Field:Value,Field:Value,...,Field:Value
@@ -67,7 +77,7 @@ var updateDesc = `更新文档项目配置
         # 特殊字段meta系统内置字段：
             # _sep: 当meta内部字段的值为多值类型时，指定其分隔符，默认是 |
         # 上述部分字段可以将值设为 - 表示重置为空，允许列表如下：
-            requirement index secret before after
+            requirement index secret before after formats schedule
 
 第二种方式，通过 file 选项：
 
@@ -111,10 +121,9 @@ var updateCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		rule := make(map[string]interface{})
-		var isUpFile bool
-		var fileMD5 string
+		var ok, fail []string
 		if text != "" {
+			rule := make(map[string]interface{})
 			var ssl string
 			for _, kv := range strings.Split(text, ",") {
 				kvs := strings.Split(kv, sep)
@@ -139,7 +148,7 @@ var updateCmd = &cobra.Command{
 						os.Exit(1)
 					}
 				} else {
-					allowEmpty := []string{"requirement", "index", "secret,", "before", "after"}
+					allowEmpty := []string{"requirement", "index", "secret,", "before", "after", "formats", "schedule"}
 					if value == vars.ResetEmpty && gtc.StrInSlice(field, allowEmpty) {
 						value = ""
 					}
@@ -149,50 +158,18 @@ var updateCmd = &cobra.Command{
 			if ssl != "" {
 				rule["ssl"] = ssl
 			}
-		} else {
-			if !gtc.IsFile(file) {
-				fmt.Println("not found file")
+			if len(rule) <= 0 {
+				fmt.Println("empty rule")
 				os.Exit(1)
 			}
-			//Check if it needs to be updated
-			md5 := opt.GetMeta(vars.PUFMD5)
-			isUpFile = true
-			fileMD5, _ = gtc.MD5File(file)
-			if md5 != "" && fileMD5 != "" && fileMD5 == md5 {
-				fmt.Println("not updated")
-				return
-			}
-			cfg, err := conf.New(file)
-			if err != nil {
+			ok, fail, err = pm.Update(&opt, rule)
+		} else {
+			ok, fail, err = pm.UpdateFromFile(&opt, file)
+			if err == lib.ErrNotUpdated {
 				fmt.Println(err)
-				os.Exit(1)
-			}
-			for k, v := range cfg.SecHash("project") {
-				if gtc.StrInSlice(k, []string{"latest"}) {
-					rule[k] = v
-				}
-			}
-			for k, v := range cfg.SecHash("sphinx") {
-				if gtc.StrInSlice(k, []string{"sourcedir", "lang", "builder"}) {
-					rule[k] = v
-				}
-			}
-			for k, v := range cfg.SecHash("python") {
-				if gtc.StrInSlice(k, []string{"version", "requirement", "install", "index"}) {
-					rule[k] = v
-				}
+				return
 			}
 		}
-
-		if len(rule) <= 0 {
-			fmt.Println("empty rule")
-			os.Exit(1)
-		}
-
-		if isUpFile {
-			(&opt).UpdateMeta(vars.PUFMD5, fileMD5)
-		}
-		ok, fail, err := pm.Update(&opt, rule)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(128)
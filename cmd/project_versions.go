@@ -0,0 +1,93 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"pkg/tcw.im/rtfd/pkg/build"
+	"pkg/tcw.im/rtfd/pkg/util"
+
+	"github.com/spf13/cobra"
+)
+
+var versionsDesc = `文档项目已发布的文档版本管理
+
+列出各版本的语言、占用空间、最近一次构建状态与时间，
+隐藏的版本不在文档的版本列表中显示但仍可访问，别名是指向某个版本的链接。
+构建标签后会自动将 stable 指向版本号最大的正式版本，手动设置 stable 别名后不再自动维护。
+
+    $ rtfd p versions <NAME>
+    $ rtfd p versions delete <NAME> <VERSION>
+    $ rtfd p versions hide <NAME> <VERSION>
+    $ rtfd p versions unhide <NAME> <VERSION>
+    $ rtfd p versions alias <NAME> stable v2.3.1`
+
+// versionsCmd represents the project versions command
+var versionsCmd = &cobra.Command{
+	Use:   "versions <name>",
+	Short: "列出及管理文档项目已发布的版本",
+	Long:  versionsDesc,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := build.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+		vs, err := b.Versions(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(128)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tLANGS\tSIZE\tSTATE\tBTIME\tFLAGS")
+		for _, v := range vs {
+			var flags []string
+			if v.Latest {
+				flags = append(flags, "latest")
+			}
+			if v.Hidden {
+				flags = append(flags, "hidden")
+			}
+			size, state := util.HumanSize(v.Size), string(v.State)
+			if v.Target != "" {
+				flags = append(flags, "-> "+v.Target)
+				size = "-"
+			}
+			if state == "" {
+				state = "-"
+			}
+			btime := v.Btime
+			if btime == "" {
+				btime = "-"
+			}
+			fmt.Fprintf(
+				w, "%s\t%s\t%s\t%s\t%s\t%s\n", v.Name, strings.Join(v.Langs, ","),
+				size, state, btime, strings.Join(flags, ","),
+			)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	projectCmd.AddCommand(versionsCmd)
+}
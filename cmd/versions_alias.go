@@ -0,0 +1,50 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"pkg/tcw.im/rtfd/pkg/build"
+
+	"github.com/spf13/cobra"
+)
+
+// versionsAliasCmd represents the project versions alias command
+var versionsAliasCmd = &cobra.Command{
+	Use:   "alias <name> <alias> <target>",
+	Short: "设置文档版本别名，如 stable 指向 v2.3.1，已存在时改为指向新版本",
+	Args:  cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := build.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+		err = b.AliasVersion(args[0], args[1], args[2])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(128)
+		}
+		fmt.Printf("%s -> %s\n", args[1], args[2])
+	},
+}
+
+func init() {
+	versionsCmd.AddCommand(versionsAliasCmd)
+}
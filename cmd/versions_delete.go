@@ -0,0 +1,50 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"pkg/tcw.im/rtfd/pkg/build"
+
+	"github.com/spf13/cobra"
+)
+
+// versionsDeleteCmd represents the project versions delete command
+var versionsDeleteCmd = &cobra.Command{
+	Use:   "delete <name> <version>",
+	Short: "删除文档版本（各语言的文档、下载文件、构建结果及其别名）或别名",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := build.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+		err = b.DeleteVersion(args[0], args[1])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(128)
+		}
+		fmt.Println("deleted")
+	},
+}
+
+func init() {
+	versionsCmd.AddCommand(versionsDeleteCmd)
+}
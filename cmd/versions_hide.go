@@ -0,0 +1,50 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"pkg/tcw.im/rtfd/pkg/build"
+
+	"github.com/spf13/cobra"
+)
+
+// versionsHideCmd represents the project versions hide command
+var versionsHideCmd = &cobra.Command{
+	Use:   "hide <name> <version>",
+	Short: "隐藏文档版本，隐藏后不在版本列表中显示但仍可访问",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := build.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+		err = b.HideVersion(args[0], args[1], true)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(128)
+		}
+		fmt.Println("hidden")
+	},
+}
+
+func init() {
+	versionsCmd.AddCommand(versionsHideCmd)
+}
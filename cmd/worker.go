@@ -0,0 +1,82 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"pkg/tcw.im/rtfd/pkg/build"
+
+	"github.com/spf13/cobra"
+)
+
+var workerDesc = `运行构建worker，从Redis任务队列中取出构建任务运行
+
+worker可运行在API服务以外的主机上，此时各主机需使用同一Redis，
+且数据目录（base_dir）中的 docs、logs 需为共享存储，以便nginx提供文档访问。
+收到退出信号后不再取出新任务，运行中的构建完成后退出。`
+
+// workerCmd represents the worker command
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "运行构建worker",
+	Long:  workerDesc,
+	Run: func(cmd *cobra.Command, args []string) {
+		concurrency, err := cmd.Flags().GetInt("concurrency")
+		if err != nil || concurrency < 1 {
+			fmt.Printf("invalid param(concurrency): %v\n", concurrency)
+			os.Exit(1)
+		}
+
+		b, err := build.New(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(127)
+		}
+
+		stop := make(chan struct{})
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			fmt.Println("stopping, waiting for running builds")
+			close(stop)
+		}()
+
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			w := build.NewWorker(b, i)
+			fmt.Printf("worker %s started\n", w.Name)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w.Run(stop)
+			}()
+		}
+		wg.Wait()
+		b.WaitNotify()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(workerCmd)
+	workerCmd.Flags().IntP("concurrency", "c", 2, "同时运行的构建任务数")
+}
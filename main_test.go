@@ -53,4 +53,9 @@ func TestDefaultConf(t *testing.T) {
 	if err != nil {
 		t.Fatal("invalid api.port")
 	}
+
+	buildSec := cfg.Section("build")
+	if w, err := buildSec.Key("workers").Int(); err != nil || w < 1 {
+		t.Fatal("invalid build.workers")
+	}
 }
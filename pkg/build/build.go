@@ -17,21 +17,39 @@
 package build
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"pkg/tcw.im/rtfd/assets"
 	"pkg/tcw.im/rtfd/pkg/conf"
 	"pkg/tcw.im/rtfd/pkg/lib"
 	"pkg/tcw.im/rtfd/pkg/util"
 	"pkg/tcw.im/rtfd/vars"
+
+	"pkg.tcw.im/gtc"
 )
 
+// timeLayout 同 util.GetNow 的时间格式
+const timeLayout = "2006-01-02 15:04:05"
+
+// ErrCancelled 构建已被取消
+var ErrCancelled = errors.New("build cancelled")
+
+// ErrFinished 构建已结束，无法取消
+var ErrFinished = errors.New("build has finished")
+
 // Builder 构建器
 type Builder struct {
 	// 配置文件路径
@@ -40,6 +58,24 @@ type Builder struct {
 	sh string
 	// 项目管理器
 	pm *lib.ProjectManager
+	// 正在异步投递的构建通知
+	notifying sync.WaitGroup
+}
+
+// Task 单次构建任务
+type Task struct {
+	// 构建ID
+	ID string
+	// 文档项目名
+	Name string
+	// 分支或标签
+	Branch string
+	// 发起构建的来源
+	Sender vars.Sender
+	// 强制构建，即使提交与最近一次成功构建相同
+	Force bool
+	// 由worker从队列中取出运行，此时命令行来源的构建也不在前台输出
+	queued bool
 }
 
 // New 新建构建器实例
@@ -57,78 +93,420 @@ func New(path string) (b *Builder, err error) {
 	if err != nil {
 		return
 	}
-	return &Builder{path, sh, pm}, nil
+	return &Builder{path: path, sh: sh, pm: pm}, nil
+}
+
+// NewTask 生成构建任务，分支为空时使用项目 latest 所指向的分支
+func (b *Builder) NewTask(name, branch string, sender vars.Sender) (*Task, error) {
+	name = strings.ToLower(name)
+	if !b.pm.HasName(name) {
+		return nil, errors.New("not found project")
+	}
+	if branch == "" {
+		opt, err := b.pm.GetName(name)
+		if err != nil {
+			return nil, err
+		}
+		branch = opt.Latest
+	}
+	return &Task{ID: genID(), Name: name, Branch: branch, Sender: sender}, nil
 }
 
 // Build 默认方式构建文档
 func (b *Builder) Build(name, branch string, sender vars.Sender) error {
-	return b.build(name, branch, sender, false, false)
+	return b.buildWith(name, branch, sender, false, false)
 }
 
 // BuildWithDebug 调试方式构建文档
 func (b *Builder) BuildWithDebug(name, branch string, sender vars.Sender) error {
-	return b.build(name, branch, sender, true, false)
+	return b.buildWith(name, branch, sender, true, false)
 }
 
 // BuildWithLog 构建文档时记录日志（cli方式除外）
 func (b *Builder) BuildWithLog(name, branch string, sender vars.Sender) error {
-	return b.build(name, branch, sender, false, true)
+	return b.buildWith(name, branch, sender, false, true)
 }
 
 // BuildWithAll 以调试模式构建文档并记录日志
 func (b *Builder) BuildWithAll(name, branch string, sender vars.Sender) error {
-	return b.build(name, branch, sender, true, true)
+	return b.buildWith(name, branch, sender, true, true)
+}
+
+// BuildTask 构建队列中的任务，同 BuildWithLog
+func (b *Builder) BuildTask(t *Task) error {
+	return b.build(t, false, true)
+}
+
+// RunTask 以指定方式构建任务，isDebug、isLog 同 BuildWithAll
+func (b *Builder) RunTask(t *Task, isDebug bool, isLog bool) error {
+	return b.build(t, isDebug, isLog)
+}
+
+func (b *Builder) buildWith(name, branch string, sender vars.Sender, isDebug bool, isLog bool) error {
+	t, err := b.NewTask(name, branch, sender)
+	if err != nil {
+		return err
+	}
+	return b.build(t, isDebug, isLog)
+}
+
+// 构建方式
+const (
+	// ModeNative 内置的构建流程
+	ModeNative = "native"
+	// ModeScript 使用构建脚本 builder.sh
+	ModeScript = "script"
+)
+
+// runner 单次构建的运行上下文，记录当前运行的命令进程组，用于超时与取消
+type runner struct {
+	b     *Builder
+	task  *Task
+	debug bool
+	// 运行时目录
+	runtime string
+	stime   string
+	host    string
+	// 项目的构建环境变量，KEY=VALUE 形式
+	env []string
+	// 遮蔽构建环境变量值
+	mask func(string) string
+	// 每行输出的处理
+	out func(line string)
+
+	mu       sync.Mutex
+	pid      int
+	timedOut atomic.Bool
+}
+
+// started 记录当前运行的命令进程组
+func (r *runner) started(pid int) {
+	r.mu.Lock()
+	r.pid = pid
+	r.mu.Unlock()
+	r.b.pm.SetRunning(lib.Running{
+		ID: r.task.ID, Name: r.task.Name, Branch: r.task.Branch, Pid: pid,
+		Runtime: r.runtime, Host: r.host, Stime: r.stime,
+	})
+}
+
+// exited 命令结束后清除登记的进程组，避免终止已被系统复用的进程组
+func (r *runner) exited() {
+	r.mu.Lock()
+	r.pid = 0
+	r.mu.Unlock()
+	r.b.pm.SetRunning(lib.Running{
+		ID: r.task.ID, Name: r.task.Name, Branch: r.task.Branch,
+		Runtime: r.runtime, Host: r.host, Stime: r.stime,
+	})
+}
+
+// kill 终止当前运行的命令进程组，没有命令运行时不做处理
+func (r *runner) kill() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pid > 0 {
+		util.KillGroup(r.pid)
+	}
+}
+
+// aborted 构建是否已超时或被取消
+func (r *runner) aborted() bool {
+	if r.timedOut.Load() {
+		return true
+	}
+	rec, err := r.b.pm.GetBuildByID(r.task.Name, r.task.ID)
+	return err == nil && rec.State == lib.StateCancelled
+}
+
+// printf 写入一行构建输出
+func (r *runner) printf(format string, a ...interface{}) {
+	r.out(fmt.Sprintf(format, a...))
+}
+
+// run 在 dir 目录中运行命令，env 为空时继承当前进程的环境变量
+func (r *runner) run(dir string, env []string, name string, args ...string) error {
+	if r.debug {
+		r.printf("+ %s %s\n", name, strings.Join(args, " "))
+	}
+	return r.exec(dir, env, name, args...)
+}
+
+// exec 运行命令并在其运行期间登记进程组
+func (r *runner) exec(dir string, env []string, name string, args ...string) error {
+	err := util.RunCmdStreamIn(dir, env, name, args, r.started, r.out)
+	r.exited()
+	return err
 }
 
 // build 构建文档
-// - isDebug 则以 `bash -x` 模式调试运行
-// - isLog 则对脚本每行输出记录日志
-func (b *Builder) build(name, branch string, sender vars.Sender, isDebug bool, isLog bool) error {
-	if !b.pm.HasName(name) {
-		return errors.New("not found project")
+// - isDebug 则调试运行（脚本方式以 `bash -x` 运行，内置方式打印执行的命令）
+// - isLog 则对每行输出记录日志
+func (b *Builder) build(t *Task, isDebug bool, isLog bool) error {
+	name, branch, sender := t.Name, t.Branch, t.Sender
+	// 最后执行：通知在释放运行记录、日志文件与运行时目录之后异步投递
+	var notifications []notification
+	defer func() { b.dispatch(name, notifications) }()
+
+	runtime := filepath.Join(b.pm.CFG().BaseDir(), "runtimes", t.ID)
+	if err := os.MkdirAll(runtime, 0755); err != nil {
+		return err
+	}
+	defer os.RemoveAll(runtime)
+
+	logfile := b.pm.LogPath(name, t.ID)
+	if err := os.MkdirAll(filepath.Dir(logfile), 0755); err != nil {
+		return err
 	}
-	data, err := b.pm.GetName(name)
+	fd, err := os.Create(logfile)
 	if err != nil {
 		return err
 	}
-	if branch == "" {
-		branch = data.Latest
+	defer fd.Close()
+
+	opt, err := b.pm.GetName(name)
+	if err != nil {
+		return err
 	}
-	var args []string
-	if isDebug {
-		args = []string{"-x", b.sh, "-n", name, "-b", branch, "-c", b.path}
-	} else {
-		args = []string{b.sh, "-n", name, "-b", branch, "-c", b.path}
+	env, err := b.pm.GetEnv(name)
+	if err != nil {
+		return err
+	}
+	mask := maskEnv(env)
+	timeout := b.pm.CFG().MustInt("build", "timeout", 3600)
+	if opt.Timeout > 0 {
+		timeout = opt.Timeout
 	}
 
-	status := false
-	usedtime := -1
-	util.RunCmdStream("bash", args, func(line string) {
-		if sender == vars.CLISender {
-			fmt.Printf(line)
-		} else if isLog {
-			log.Printf(line)
-		}
-		if strings.HasPrefix(line, "Build Successfully") {
-			status = true
-			stime := strings.Split(line, " ")[2]
-			itime, _ := strconv.Atoi(stime)
-			if itime > 0 {
-				usedtime = itime
+	begin := time.Now()
+	start := util.GetNow()
+	err = b.pm.BuildStart(name, lib.Result{
+		ID: t.ID, Branch: branch, State: lib.StateRunning, Sender: sender,
+		Stime: start, Usedtime: -1, Log: logfile,
+	})
+	if err != nil {
+		return err
+	}
+	defer b.pm.DelRunning(t.ID)
+
+	// 命令行前台运行的构建直接输出，并可用 Ctrl-C 取消
+	foreground := sender == vars.CLISender && !t.queued
+	host, _ := os.Hostname()
+	r := &runner{
+		b: b, task: t, debug: isDebug, runtime: runtime, stime: start, host: host,
+		env: lib.EnvList(env), mask: mask,
+		out: func(line string) {
+			line = mask(line)
+			fd.WriteString(line)
+			if foreground {
+				fmt.Printf(line)
+			} else if isLog {
+				log.Printf(line)
 			}
+		},
+	}
+
+	// 提交未变化时跳过构建
+	if !t.Force {
+		if last, ok := b.unchanged(opt, branch); ok {
+			r.printf("Commit %s has not changed since build %s, skipped.\n", last.Commit, last.ID)
+			return b.pm.HistoryUpdate(name, lib.Result{
+				ID: t.ID, Branch: branch, State: lib.StateSkipped, Sender: sender,
+				Stime: start, Btime: util.GetNow(), Usedtime: int(time.Since(begin).Seconds()),
+				Log: logfile, Commit: last.Commit, CommitAuthor: last.CommitAuthor,
+				CommitSubject: last.CommitSubject, CommitTime: last.CommitTime,
+			})
 		}
-	})
+	}
+
+	// 命令行构建时，Ctrl-C 取消构建（终止整个构建进程组）
+	if foreground {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sig)
+		go func() {
+			if _, ok := <-sig; ok {
+				b.Cancel(t.ID)
+			}
+		}()
+	}
+
+	if timeout > 0 {
+		timer := time.AfterFunc(time.Duration(timeout)*time.Second, func() {
+			r.timedOut.Store(true)
+			r.kill()
+		})
+		defer timer.Stop()
+	}
+
+	var (
+		st       buildStatus
+		exitCode int
+	)
+	// 构建脚本仅支持 Sphinx
+	script := b.pm.CFG().MustKey("build", "mode", ModeNative) == ModeScript
+	if script && !opt.IsMkDocs() && !opt.IsCustom() {
+		st, exitCode = b.runScript(r)
+	} else {
+		st = newPipeline(r, opt).execute()
+		exitCode = st.Code
+	}
+
+	// 仅当正常退出且报告了全部步骤完成时才是构建成功
+	status := exitCode == 0 && st.Done
+	usedtime := int(time.Since(begin).Seconds())
+	state := lib.StateFailing
+	if status {
+		state = lib.StatePassing
+	}
+	if r.timedOut.Load() {
+		state = lib.StateTimeout
+		fd.WriteString(fmt.Sprintf("Build timed out, killed after %d seconds.\n", usedtime))
+	}
+	// 已有语言发布了本次构建，文档处于新旧版本混合的状态
+	if !status && st.Partial {
+		state = lib.StatePartial
+	}
+	step := ""
+	if !status {
+		step = st.FailedStep
+	}
 	rst := lib.Result{
-		Status: status, Sender: sender, Usedtime: usedtime,
-		Btime: util.GetNow(), Branch: branch,
+		ID: t.ID, Status: status, State: state, Sender: sender, Usedtime: usedtime,
+		Stime: start, Btime: util.GetNow(), Branch: branch, Log: logfile,
+		ExitCode: exitCode, Step: step, Steps: st.Steps, Commit: st.Commit,
+		CommitAuthor: st.CommitAuthor, CommitSubject: st.CommitSubject, CommitTime: st.CommitTime,
+		Warnings: len(st.Warnings), WarningText: warningText(st.Warnings),
 	}
-	err = b.pm.BuildRecord(name, branch, rst)
+	prev, _ := b.pm.GetBuildset(name, branch)
+	ok, err := b.pm.FinishBuild(name, branch, rst)
 	if err != nil {
 		return err
 	}
+	// 已被取消的构建，其记录由 Cancel 写入
+	if !ok {
+		return ErrCancelled
+	}
+	notifications = b.notify(r, rst, prev.State)
+	if pruned, err := b.Prune(name, false); err != nil {
+		r.printf("Prune versions failed: %s\n", err)
+	} else if len(pruned) > 0 {
+		r.printf("Pruned versions: %s\n", strings.Join(pruned, ", "))
+	}
 	return nil
 }
 
+// unchanged 远程分支或标签所指向的提交与最近一次成功构建的相同时返回该次构建结果
+func (b *Builder) unchanged(opt lib.Options, branch string) (last lib.Result, ok bool) {
+	last, err := b.pm.LastPassing(opt.Name, branch)
+	if err != nil || last.Commit == "" {
+		return last, false
+	}
+	// 已发布的文档被删除（如 prune、versions delete 或手动删除）时需要重新构建
+	for _, dir := range b.langDirs(opt) {
+		if !gtc.IsDir(filepath.Join(dir, branch)) {
+			return last, false
+		}
+	}
+	sha, err := util.GitRemoteHead(opt.URL, branch)
+	if err != nil {
+		return last, false
+	}
+	return last, sha == last.Commit
+}
+
+// runScript 以构建脚本方式构建，返回由状态文件解析出的构建状态与脚本退出码
+func (b *Builder) runScript(r *runner) (st buildStatus, exitCode int) {
+	t := r.task
+	statusFile := r.runtime + ".status"
+	defer os.Remove(statusFile)
+
+	args := []string{b.sh, "-n", t.Name, "-b", t.Branch, "-c", b.path, "-r", r.runtime, "-s", statusFile}
+	if r.debug {
+		args = append([]string{"-x"}, args...)
+	}
+	env := append(os.Environ(), r.env...)
+	err := r.exec("", env, "bash", args...)
+	exitCode = util.ExitCode(err)
+	st, _ = parseStatus(statusFile)
+	return
+}
+
+// Cancel 取消正在运行的构建：终止构建进程组、删除运行时目录并记录为已取消。
+// 构建运行在其他主机时，仅登记取消请求，由运行该构建的worker执行取消。
+// 取消与构建结束的记录是原子的，已结束的构建返回 ErrFinished。
+func (b *Builder) Cancel(id string) error {
+	r, err := b.pm.GetRunning(id)
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	if r.Host != host {
+		return b.pm.RequestCancel(id)
+	}
+
+	rst, err := b.pm.GetBuildByID(r.Name, id)
+	if err != nil {
+		return err
+	}
+	rst.Status = false
+	rst.State = lib.StateCancelled
+	rst.Btime = util.GetNow()
+	if st, e := time.ParseInLocation(timeLayout, rst.Stime, time.Local); e == nil {
+		rst.Usedtime = int(time.Since(st).Seconds())
+	}
+	ok, err := b.pm.FinishBuild(r.Name, rst.Branch, rst)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrFinished
+	}
+
+	// 两个命令之间被取消时没有进程组，由构建在下一步骤前检测到取消后停止
+	if r.Pid > 0 {
+		err = util.KillGroup(r.Pid)
+		if err != nil && err != syscall.ESRCH {
+			return err
+		}
+	}
+	runtimes := filepath.Join(b.pm.CFG().BaseDir(), "runtimes") + string(filepath.Separator)
+	if strings.HasPrefix(r.Runtime, runtimes) {
+		os.RemoveAll(r.Runtime)
+	}
+	return b.pm.DelRunning(id)
+}
+
+// minMaskLen 短于此长度的环境变量值不做遮蔽，以免误改构建输出
+const minMaskLen = 4
+
+// maskEnv 返回将构建输出中的环境变量值替换为 *** 的函数
+func maskEnv(env map[string]string) func(string) string {
+	var olds []string
+	for _, v := range env {
+		if len(v) >= minMaskLen {
+			olds = append(olds, v)
+		}
+	}
+	if len(olds) == 0 {
+		return func(s string) string { return s }
+	}
+	// 长的值优先替换，避免其包含的短值先被替换
+	sort.Slice(olds, func(i, j int) bool { return len(olds[i]) > len(olds[j]) })
+	pairs := make([]string, 0, len(olds)*2)
+	for _, v := range olds {
+		pairs = append(pairs, v, "***")
+	}
+	return strings.NewReplacer(pairs...).Replace
+}
+
+// genID 生成构建ID，格式为时间加随机串，可按字符串排序
+func genID() string {
+	r := make([]byte, 3)
+	rand.Read(r)
+	return time.Now().Format("20060102150405") + "-" + hex.EncodeToString(r)
+}
+
 func genBuilderScript(dir string) (sh string, err error) {
 	if dir == "" {
 		dir = os.TempDir()
@@ -0,0 +1,109 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 构建缓存：每个项目一个增量更新的git镜像仓库，以及按依赖哈希复用的虚拟环境
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pkg/tcw.im/rtfd/pkg/util"
+
+	"pkg.tcw.im/gtc"
+)
+
+const (
+	// git镜像仓库目录名
+	mirrorName = "mirror.git"
+	// 虚拟环境所在目录名
+	venvsName = "venvs"
+	// 虚拟环境创建并安装依赖成功后写入的标记文件
+	venvReady = ".rtfd-ready"
+	// 超过此时间未使用的虚拟环境会被清理
+	venvExpire = 7 * 24 * time.Hour
+)
+
+// venvKey 虚拟环境的缓存标识，由Python解释器、版本与依赖文件内容计算
+func venvKey(repo, py, version string, reqs []string) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(py + "\x00" + version + "\x00"))
+	for _, req := range reqs {
+		data, err := os.ReadFile(filepath.Join(repo, req))
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(req + "\x00"))
+		h.Write(data)
+		h.Write([]byte("\x00"))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// git 运行git命令，调试输出时隐藏仓库地址中的认证信息
+func (p *pipeline) git(dir string, args ...string) error {
+	if p.r.debug {
+		pub, _ := util.PublicGitURL(p.opt.URL)
+		p.r.printf("+ git %s\n", strings.ReplaceAll(strings.Join(args, " "), p.opt.URL, pub))
+	}
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	return p.r.exec(dir, env, "git", args...)
+}
+
+// updateMirror 首次构建时创建git镜像仓库，之后增量获取更新
+func (p *pipeline) updateMirror(mirror string) error {
+	if !gtc.IsDir(mirror) {
+		err := p.git(filepath.Dir(mirror), "clone", "--mirror", p.opt.URL, mirrorName)
+		if err != nil {
+			os.RemoveAll(mirror)
+		}
+		return err
+	}
+	// 项目地址可能已更新
+	if err := p.git(mirror, "remote", "set-url", "origin", p.opt.URL); err != nil {
+		return err
+	}
+	return p.git(mirror, "fetch", "--prune", "origin")
+}
+
+// pruneVenvs 清理长时间未使用且未被其他构建占用的虚拟环境
+func pruneVenvs(dir, current string) {
+	ds, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, d := range ds {
+		key := d.Name()
+		if !d.IsDir() || key == current {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(dir, key, venvReady))
+		if err == nil && time.Since(fi.ModTime()) < venvExpire {
+			continue
+		}
+		lock, err := util.TryLock(filepath.Join(dir, key+".lock"))
+		if err != nil {
+			continue
+		}
+		os.RemoveAll(filepath.Join(dir, key))
+		lock.Close()
+	}
+}
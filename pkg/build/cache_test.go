@@ -0,0 +1,32 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVenvKey(t *testing.T) {
+	repo := t.TempDir()
+	req := "requirements.txt"
+	os.WriteFile(filepath.Join(repo, req), []byte("sphinx==4.0.0\n"), 0644)
+
+	k1, err := venvKey(repo, "python3", "3", []string{req})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, _ := venvKey(repo, "python3", "3", []string{req})
+	if k1 != k2 {
+		t.Fatal("venv key should be stable")
+	}
+	if k, _ := venvKey(repo, "python2", "2", []string{req}); k == k1 {
+		t.Fatal("venv key should change with python")
+	}
+	os.WriteFile(filepath.Join(repo, req), []byte("sphinx==4.1.0\n"), 0644)
+	if k, _ := venvKey(repo, "python3", "3", []string{req}); k == k1 {
+		t.Fatal("venv key should change with requirements")
+	}
+	if _, err := venvKey(repo, "python3", "3", []string{"none.txt"}); err == nil {
+		t.Fatal("should raise error for missing requirement file")
+	}
+}
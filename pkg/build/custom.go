@@ -0,0 +1,49 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// custom 使用自定义命令构建文档：每种语言执行一次构建命令，再将输出目录复制到暂存目录，
+// 构建命令可通过环境变量 RTFD_NAME、RTFD_BRANCH、RTFD_LANG 获取构建信息
+func (p *pipeline) custom() error {
+	// 规则文件可能修改了构建命令与输出目录，构建前再次检测
+	if err := p.opt.CheckCustom(); err != nil {
+		return err
+	}
+	output := filepath.Join(p.repo, p.opt.OutputDir)
+	return p.buildLangs(func(lang, out string) error {
+		env := append(
+			p.env(), "RTFD_NAME="+p.opt.Name, "RTFD_BRANCH="+p.r.task.Branch, "RTFD_LANG="+lang,
+		)
+		os.RemoveAll(output)
+		if err := p.r.run(p.repo, env, "bash", "-c", p.opt.Command); err != nil {
+			return err
+		}
+		if fi, err := os.Stat(output); err != nil || !fi.IsDir() {
+			return fmt.Errorf("Not found output directory %s", p.opt.OutputDir)
+		}
+		if err := os.MkdirAll(out, 0755); err != nil {
+			return err
+		}
+		return p.r.run(p.repo, nil, "cp", "-a", output+"/.", out)
+	})
+}
@@ -0,0 +1,218 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 下载格式：在HTML之外额外构建PDF、EPUB与打包的HTML，仅支持Sphinx
+
+package build
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+
+	"pkg.tcw.im/gtc"
+)
+
+// artifactName 下载文件名，如 rtfd-master.pdf
+func artifactName(name, branch, ext string) string {
+	return name + "-" + strings.ReplaceAll(branch, "/", "-") + "." + ext
+}
+
+// downloadsStaging 下载文件的暂存目录，位于运行时目录中
+func (p *pipeline) downloadsStaging(lang string) string {
+	return filepath.Join(p.r.runtime, "_downloads", lang)
+}
+
+// sphinxBuild 以指定构建器运行 sphinx-build，extra 为额外的选项
+func (p *pipeline) sphinxBuild(lang, builder, out string, extra ...string) error {
+	sb := filepath.Join(p.venv, "bin", "sphinx-build")
+	args := append([]string{"-E", "-T", "-D", "language=" + lang, "-b", builder}, extra...)
+	return p.r.run(p.repo, p.env(), sb, append(args, p.opt.SourceDir, out)...)
+}
+
+// formats 为各语言构建下载格式并发布，html 使用已发布的HTML文档；
+// 某个格式失败时继续构建其他格式，已成功的仍会发布
+func (p *pipeline) formats() error {
+	var errs []error
+	docs := filepath.Join(p.cfg.BaseDir(), "docs", p.opt.Name)
+	for _, lang := range strings.Split(p.opt.Lang, ",") {
+		lang = strings.TrimSpace(lang)
+		if lang == "" {
+			continue
+		}
+		// 已发布的版本是指向暂存目录的链接
+		html, err := filepath.EvalSymlinks(filepath.Join(docs, lang, p.r.task.Branch))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := p.buildFormats(lang, html); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", lang, err))
+		}
+	}
+	if err := p.publishDownloads(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// buildFormats 构建项目设置的下载格式，html 为已构建好的HTML目录
+func (p *pipeline) buildFormats(lang, html string) error {
+	formats := p.opt.FormatList()
+	if len(formats) == 0 {
+		return nil
+	}
+	dst := p.downloadsStaging(lang)
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	work := filepath.Join(p.r.runtime, "_formats", lang)
+	name := func(ext string) string {
+		return filepath.Join(dst, artifactName(p.opt.Name, p.r.task.Branch, ext))
+	}
+	var errs []error
+	for _, f := range formats {
+		var err error
+		switch f {
+		case lib.FormatPDF:
+			err = p.buildPDF(lang, filepath.Join(work, "latex"), name("pdf"))
+		case lib.FormatEPUB:
+			err = p.buildEPUB(lang, filepath.Join(work, "epub"), name("epub"))
+		case lib.FormatHTMLZip:
+			prefix := strings.TrimSuffix(filepath.Base(name("zip")), ".zip")
+			err = zipDir(html, name("zip"), prefix)
+		default:
+			err = fmt.Errorf("invalid format: %s", f)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("build %s failed: %w", f, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// buildPDF 使用 latex 构建器生成tex文件，再由 latexmk 编译为PDF
+func (p *pipeline) buildPDF(lang, dir, dst string) error {
+	if err := p.sphinxBuild(lang, "latex", dir); err != nil {
+		return err
+	}
+	texs, _ := filepath.Glob(filepath.Join(dir, "*.tex"))
+	if len(texs) == 0 {
+		return errors.New("not found tex file")
+	}
+	sort.Strings(texs)
+	tex := texs[0]
+	args := []string{"-pdf", "-f", "-dvi-", "-ps-", "-interaction=nonstopmode", filepath.Base(tex)}
+	if gtc.IsFile(filepath.Join(dir, "latexmkrc")) {
+		args = append([]string{"-r", "latexmkrc"}, args...)
+	}
+	// latexmk -f 在有错误时仍会尽量生成PDF，以PDF是否生成为准
+	err := p.r.run(dir, p.env(), "latexmk", args...)
+	pdf := strings.TrimSuffix(tex, ".tex") + ".pdf"
+	if !gtc.IsFile(pdf) {
+		if err == nil {
+			err = errors.New("not found pdf file")
+		}
+		return err
+	}
+	return os.Rename(pdf, dst)
+}
+
+// buildEPUB 使用 epub 构建器生成电子书
+func (p *pipeline) buildEPUB(lang, dir, dst string) error {
+	if err := p.sphinxBuild(lang, "epub", dir); err != nil {
+		return err
+	}
+	epubs, _ := filepath.Glob(filepath.Join(dir, "*.epub"))
+	if len(epubs) == 0 {
+		return errors.New("not found epub file")
+	}
+	return os.Rename(epubs[0], dst)
+}
+
+// publishDownloads 以暂存的下载文件替换各语言该分支原有的下载文件
+func (p *pipeline) publishDownloads() error {
+	ds, err := os.ReadDir(filepath.Join(p.r.runtime, "_downloads"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, d := range ds {
+		lang := d.Name()
+		dst := p.r.b.pm.DownloadsDir(p.opt.Name, lang, p.r.task.Branch)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		old := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".old-"+p.r.task.ID)
+		if err := os.Rename(dst, old); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Rename(p.downloadsStaging(lang), dst); err != nil {
+			os.Rename(old, dst)
+			return err
+		}
+		os.RemoveAll(old)
+	}
+	return nil
+}
+
+// zipDir 将目录打包为zip文件，包内文件位于 prefix 目录下
+func zipDir(src, dst, prefix string) error {
+	fd, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	zw := zip.NewWriter(fd)
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		w, err := zw.Create(filepath.ToSlash(filepath.Join(prefix, rel)))
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	})
+	if err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,38 @@
+package build
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArtifactName(t *testing.T) {
+	if n := artifactName("rtfd", "feature/x", "pdf"); n != "rtfd-feature-x.pdf" {
+		t.Fatalf("artifact name error: %s", n)
+	}
+}
+
+func TestZipDir(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "_static"), 0755)
+	os.WriteFile(filepath.Join(src, "index.html"), []byte("index"), 0644)
+	os.WriteFile(filepath.Join(src, "_static", "a.css"), []byte("css"), 0644)
+
+	dst := filepath.Join(t.TempDir(), "docs.zip")
+	if err := zipDir(src, dst, "rtfd-master"); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	names := make(map[string]bool)
+	for _, f := range zr.File {
+		names[f.Name] = true
+	}
+	if len(names) != 2 || !names["rtfd-master/index.html"] || !names["rtfd-master/_static/a.css"] {
+		t.Fatalf("zip entries error: %v", names)
+	}
+}
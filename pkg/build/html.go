@@ -0,0 +1,69 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package build
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// htmlMarker 已注入内容的标记，用于避免重复注入
+const htmlMarker = "<!-- rtfd -->"
+
+// 页面已设置的图标
+var iconPat = regexp.MustCompile(`(?i)<link[^>]+rel=["']?(shortcut )?icon["'\s>]`)
+
+// 不区分大小写的 </head>，直接在原始字节中查找以免非UTF-8内容改变偏移
+var headEndPat = regexp.MustCompile(`(?i)</head>`)
+
+// injectHTML 在目录下所有HTML文件的 </head> 前插入脚本，页面未设置图标时一并插入favicon，
+// 已注入过或没有 </head> 的文件跳过，故可重复执行（dirhtml的多级目录、singlehtml的单页均适用）
+func injectHTML(dir, script, favicon string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(strings.ToLower(d.Name()), ".html") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(data, []byte(htmlMarker)) {
+			return nil
+		}
+		loc := headEndPat.FindIndex(data)
+		if loc == nil {
+			return nil
+		}
+		i := loc[0]
+		snippet := htmlMarker + script
+		if favicon != "" && !iconPat.Match(data[:i]) {
+			snippet += favicon
+		}
+		out := make([]byte, 0, len(data)+len(snippet))
+		out = append(out, data[:i]...)
+		out = append(out, snippet...)
+		out = append(out, data[i:]...)
+		return os.WriteFile(path, out, 0644)
+	})
+}
@@ -0,0 +1,63 @@
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInjectHTML(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "guide"), 0755)
+	index := filepath.Join(dir, "index.html")
+	guide := filepath.Join(dir, "guide", "index.html")
+	raw := filepath.Join(dir, "raw.html")
+	os.WriteFile(index, []byte("<html><HEAD><title>x</title></HEAD><body></body></html>"), 0644)
+	os.WriteFile(guide, []byte(`<html><head><link rel="shortcut icon" href="x.ico"></head></html>`), 0644)
+	os.WriteFile(raw, []byte("<p>fragment</p>"), 0644)
+
+	snippet := `<script src="rtfd.js"></script>`
+	favicon := `<link rel="icon" href="favicon.png">`
+	for i := 0; i < 2; i++ {
+		if err := injectHTML(dir, snippet, favicon); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ := os.ReadFile(index)
+	want := "<html><HEAD><title>x</title>" + htmlMarker + snippet + favicon + "</HEAD><body></body></html>"
+	if string(data) != want {
+		t.Fatalf("inject index error: %s", data)
+	}
+	data, _ = os.ReadFile(guide)
+	if string(data) != `<html><head><link rel="shortcut icon" href="x.ico">`+htmlMarker+snippet+"</head></html>" {
+		t.Fatalf("inject sub directory (with icon) error: %s", data)
+	}
+	data, _ = os.ReadFile(raw)
+	if string(data) != "<p>fragment</p>" {
+		t.Fatalf("file without head should not be changed: %s", data)
+	}
+}
+
+func TestInjectHTMLNonUTF8(t *testing.T) {
+	// GBK 编码的标题、非法字节及小写后长度会变化的字符（U+0130、U+212A）不能使插入位置偏移
+	cases := []struct{ head, tail string }{
+		{"<html><head><title>\xc4\xe3\xba\xc3\xca\xc0\xbd\xe7</title>", "</head><body></body></html>"},
+		{"<html><head><title>\u0130\u212a</title>", "</Head></html>"},
+		{"<head>" + strings.Repeat("\xff", 64), "</HEAD>"},
+	}
+	snippet := `<script src="rtfd.js"></script>`
+	for i, c := range cases {
+		dir := t.TempDir()
+		f := filepath.Join(dir, fmt.Sprintf("%d.html", i))
+		os.WriteFile(f, []byte(c.head+c.tail), 0644)
+		if err := injectHTML(dir, snippet, ""); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := os.ReadFile(f)
+		if string(data) != c.head+htmlMarker+snippet+c.tail {
+			t.Fatalf("inject %q error: %q", c.head+c.tail, data)
+		}
+	}
+}
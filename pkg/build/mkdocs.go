@@ -0,0 +1,114 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+
+	"pkg.tcw.im/gtc"
+)
+
+// 顶层的 extra_javascript 配置行
+var extraJSPat = regexp.MustCompile(`^extra_javascript\s*:\s*(.*)$`)
+
+// mkdocsConfig MkDocs 配置文件，多语言时优先使用 mkdocs.<lang>.yml
+func (p *pipeline) mkdocsConfig(lang string) (string, error) {
+	for _, name := range []string{"mkdocs." + lang + ".yml", "mkdocs.yml"} {
+		if gtc.IsFile(filepath.Join(p.repo, name)) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("Not found mkdocs.yml in %s", p.repo)
+}
+
+// mkdocs 使用 mkdocs build 构建文档，注入方式为conf时通过 extra_javascript 引入 rtfd.js
+func (p *pipeline) mkdocs() error {
+	js := p.jsURL()
+	mb := filepath.Join(p.venv, "bin", "mkdocs")
+	injected := make(map[string]bool)
+	return p.buildLangs(func(lang, out string) error {
+		cfg, err := p.mkdocsConfig(lang)
+		if err != nil {
+			return err
+		}
+		if p.injectMode() == lib.InjectConf && !injected[cfg] {
+			if err := injectMkDocs(filepath.Join(p.repo, cfg), js); err != nil {
+				return err
+			}
+			injected[cfg] = true
+		}
+		return p.r.run(
+			p.repo, p.env(), mb, "build", "--clean", "--config-file", cfg, "--site-dir", out,
+		)
+	})
+}
+
+// injectMkDocs 向 MkDocs 配置文件的 extra_javascript 中加入 rtfd.js，
+// 按行处理以保留原文件中的自定义标签（如 !!python/name）
+func injectMkDocs(path, js string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	item := strconv.Quote(js)
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	found := false
+	for i, line := range lines {
+		m := extraJSPat.FindStringSubmatch(strings.TrimRight(line, " \t\r"))
+		if m == nil {
+			continue
+		}
+		found = true
+		value := strings.TrimSpace(m[1])
+		if strings.HasPrefix(value, "[") {
+			// 流式列表：extra_javascript: [a.js, b.js]
+			rest := strings.TrimSpace(strings.TrimPrefix(value, "["))
+			if strings.HasPrefix(rest, "]") {
+				lines[i] = "extra_javascript: [" + item + rest
+			} else {
+				lines[i] = "extra_javascript: [" + item + ", " + rest
+			}
+			break
+		}
+		// 块列表，沿用已有列表项的缩进
+		indent := "  "
+		for _, next := range lines[i+1:] {
+			trimmed := strings.TrimSpace(next)
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			if strings.HasPrefix(trimmed, "- ") {
+				indent = next[:len(next)-len(strings.TrimLeft(next, " "))]
+			}
+			break
+		}
+		lines[i] = "extra_javascript:"
+		lines = append(lines[:i+1], append([]string{indent + "- " + item}, lines[i+1:]...)...)
+		break
+	}
+	if !found {
+		lines = append(lines, "", "#: Automatic generated by rtfd", "extra_javascript:", "  - "+item)
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
@@ -0,0 +1,46 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInjectMkDocs(t *testing.T) {
+	js := "https://rtfd.example.com/rtfd/assets/rtfd.js?name=x"
+	cases := []struct {
+		src, dst string
+	}{
+		{
+			"site_name: X\n",
+			"site_name: X\n\n#: Automatic generated by rtfd\nextra_javascript:\n  - \"" + js + "\"\n",
+		},
+		{
+			"site_name: X\nextra_javascript:\n    - a.js\ntheme: material\n",
+			"site_name: X\nextra_javascript:\n    - \"" + js + "\"\n    - a.js\ntheme: material\n",
+		},
+		{
+			"extra_javascript: [a.js, b.js]\n",
+			"extra_javascript: [\"" + js + "\", a.js, b.js]\n",
+		},
+		{
+			"extra_javascript: []\n",
+			"extra_javascript: [\"" + js + "\"]\n",
+		},
+		{
+			"extra_javascript:\nmarkdown_extensions:\n  - toc\n",
+			"extra_javascript:\n  - \"" + js + "\"\nmarkdown_extensions:\n  - toc\n",
+		},
+	}
+	f := filepath.Join(t.TempDir(), "mkdocs.yml")
+	for _, c := range cases {
+		os.WriteFile(f, []byte(c.src), 0644)
+		if err := injectMkDocs(f, js); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := os.ReadFile(f)
+		if string(data) != c.dst {
+			t.Fatalf("inject %q error, got:\n%s", c.src, data)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 构建通知：构建结果记录后，向项目设置的通知目标投递构建事件，失败时退避重试。
+// 投递在构建结束（释放运行记录与锁）后异步进行，且有最长时间限制，不会占用构建。
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg/tcw.im/rtfd/pkg/conf"
+	"pkg/tcw.im/rtfd/pkg/lib"
+	"pkg/tcw.im/rtfd/pkg/util"
+)
+
+// notifyAttempts 每个通知目标的最大尝试次数
+const notifyAttempts = 3
+
+// notifyBackoff 首次重试前的等待时间，之后每次加倍
+var notifyBackoff = 2 * time.Second
+
+// notifyTimeout 单次投递的超时时间
+const notifyTimeout = 10 * time.Second
+
+// notifyLifetime 一次构建的全部通知投递（含重试）的最长时间
+const notifyLifetime = 2 * time.Minute
+
+var notifyClient = &http.Client{Timeout: notifyTimeout}
+
+// notification 待投递的一条通知
+type notification struct {
+	target  lib.NotifyTarget
+	payload notifyPayload
+}
+
+// notifyPayload 通知内容，即通用webhook的请求体
+type notifyPayload struct {
+	Event    lib.NotifyEvent `json:"event"`
+	Project  string          `json:"project"`
+	Branch   string          `json:"branch"`
+	ID       string          `json:"id"`
+	State    lib.BuildState  `json:"state"`
+	Step     string          `json:"step,omitempty"`
+	Usedtime int             `json:"usedtime"`
+	Btime    string          `json:"btime"`
+	Commit   string          `json:"commit,omitempty"`
+	Author   string          `json:"author,omitempty"`
+	Subject  string          `json:"subject,omitempty"`
+	Warnings int             `json:"warnings"`
+}
+
+// text 通知的文本内容，用于 slack 与邮件
+func (p notifyPayload) text() string {
+	s := fmt.Sprintf("[rtfd] %s %s build %s (%s)", p.Project, p.Branch, p.State, p.Event)
+	if p.Step != "" {
+		s += fmt.Sprintf(" at step %s", p.Step)
+	}
+	s += fmt.Sprintf("\nBuild: %s, used %ds", p.ID, p.Usedtime)
+	if p.Commit != "" {
+		commit := p.Commit
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		s += fmt.Sprintf("\nCommit: %s %s (%s)", commit, p.Subject, p.Author)
+	}
+	return s
+}
+
+// notify 匹配本次构建事件的通知目标，prev 为该分支上一次构建的状态
+func (b *Builder) notify(r *runner, rst lib.Result, prev lib.BuildState) (ns []notification) {
+	targets, err := b.pm.ListNotify(r.task.Name)
+	if err != nil || len(targets) == 0 {
+		return
+	}
+	payload := notifyPayload{
+		Project: r.task.Name, Branch: rst.Branch, ID: rst.ID, State: rst.State, Step: rst.Step,
+		Usedtime: rst.Usedtime, Btime: rst.Btime, Commit: rst.Commit,
+		Author: rst.CommitAuthor, Subject: rst.CommitSubject, Warnings: rst.Warnings,
+	}
+	for _, t := range targets {
+		event := t.MatchEvent(rst.State, prev)
+		if event == "" {
+			continue
+		}
+		p := payload
+		p.Event = event
+		ns = append(ns, notification{t, p})
+		r.printf("Notify %s(%s) %s, see the delivery log for the result\n", t.Type, t.ID, event)
+	}
+	return
+}
+
+// dispatch 异步投递通知，失败时退避重试，全部投递最长 notifyLifetime，结果写入投递记录
+func (b *Builder) dispatch(name string, ns []notification) {
+	if len(ns) == 0 {
+		return
+	}
+	b.notifying.Add(1)
+	go func() {
+		defer b.notifying.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), notifyLifetime)
+		defer cancel()
+		var wg sync.WaitGroup
+		for _, n := range ns {
+			wg.Add(1)
+			go func(n notification) {
+				defer wg.Done()
+				b.pm.AddDelivery(name, deliverRetry(ctx, b.pm.CFG(), n))
+			}(n)
+		}
+		wg.Wait()
+	}()
+}
+
+// WaitNotify 等待已发出的通知投递完成，命令行构建退出前调用
+func (b *Builder) WaitNotify() {
+	b.notifying.Wait()
+}
+
+// deliverRetry 投递一条通知，失败时退避重试直至达到最大尝试次数或 ctx 结束
+func deliverRetry(ctx context.Context, cfg *conf.Config, n notification) lib.Delivery {
+	t, p := n.target, n.payload
+	d := lib.Delivery{Target: t.ID, Type: t.Type, Build: p.ID, Event: p.Event}
+	for d.Attempts = 1; ; d.Attempts++ {
+		err := deliver(ctx, cfg, t, p)
+		if err == nil {
+			d.Status, d.Error = true, ""
+			break
+		}
+		d.Error = err.Error()
+		if d.Attempts >= notifyAttempts {
+			break
+		}
+		select {
+		case <-time.After(notifyBackoff << (d.Attempts - 1)):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	d.Time = util.GetNow()
+	return d
+}
+
+// deliver 投递一次通知
+func deliver(ctx context.Context, cfg *conf.Config, t lib.NotifyTarget, p notifyPayload) error {
+	switch t.Type {
+	case lib.NotifyWebhook:
+		body, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		header := map[string]string{"X-Rtfd-Event": string(p.Event)}
+		if t.Secret != "" {
+			header["X-Rtfd-Signature"] = "sha256=" + signBody(t.Secret, body)
+		}
+		return postJSON(ctx, t.URL, body, header)
+	case lib.NotifySlack:
+		body, err := json.Marshal(map[string]string{"text": p.text()})
+		if err != nil {
+			return err
+		}
+		return postJSON(ctx, t.URL, body, nil)
+	case lib.NotifySMTP:
+		return sendMail(ctx, cfg, t.To, p)
+	}
+	return fmt.Errorf("invalid notify type: %s", t.Type)
+}
+
+// signBody 请求体的 HMAC-SHA256 签名
+func signBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// postJSON 发送JSON请求，响应状态码非2xx时视为失败
+func postJSON(ctx context.Context, url string, body []byte, header map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "rtfd")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// sendMail 通过系统配置 smtp 分区的发信服务器发送邮件，整个会话不超过 notifyTimeout
+func sendMail(ctx context.Context, cfg *conf.Config, to string, p notifyPayload) error {
+	host := cfg.GetKey("smtp", "host")
+	from := cfg.GetKey("smtp", "from")
+	if host == "" || from == "" {
+		return fmt.Errorf("smtp host or from is not configured")
+	}
+	addrs, err := mail.ParseAddressList(to)
+	if err != nil {
+		return err
+	}
+	rcpts := make([]string, len(addrs))
+	for i, a := range addrs {
+		rcpts[i] = a.Address
+	}
+	port := cfg.MustKey("smtp", "port", "25")
+	var auth smtp.Auth
+	if user := cfg.GetKey("smtp", "user"); user != "" {
+		auth = smtp.PlainAuth("", user, cfg.GetKey("smtp", "password"), host)
+	}
+	text := p.text()
+	subject := strings.SplitN(text, "\n", 2)[0]
+	msg := "From: " + from + "\r\n" +
+		"To: " + strings.Join(rcpts, ", ") + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" +
+		strings.ReplaceAll(text, "\n", "\r\n") + "\r\n"
+	return smtpSend(ctx, net.JoinHostPort(host, port), host, auth, from, rcpts, []byte(msg))
+}
+
+// smtpSend 同 smtp.SendMail，但连接与整个会话都有超时
+func smtpSend(ctx context.Context, addr, host string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	dialer := net.Dialer{Timeout: notifyTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(notifyTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp server doesn't support AUTH")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
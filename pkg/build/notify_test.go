@@ -0,0 +1,47 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+)
+
+func TestDeliverWebhook(t *testing.T) {
+	var (
+		calls int
+		got   notifyPayload
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Rtfd-Signature") != "sha256="+signBody("key", body) {
+			w.WriteHeader(403)
+			return
+		}
+		if r.Header.Get("X-Rtfd-Event") != string(lib.EventFailure) {
+			w.WriteHeader(400)
+			return
+		}
+		json.Unmarshal(body, &got)
+		w.WriteHeader(204)
+	}))
+	defer srv.Close()
+
+	p := notifyPayload{Event: lib.EventFailure, Project: "rtfd", Branch: "master", State: lib.StateFailing}
+	target := lib.NotifyTarget{Type: lib.NotifyWebhook, URL: srv.URL, Secret: "key"}
+	if err := deliver(context.Background(), nil, target, p); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 || got.Project != "rtfd" || got.State != lib.StateFailing {
+		t.Fatalf("webhook payload error: %+v", got)
+	}
+	target.Secret = "other"
+	if err := deliver(context.Background(), nil, target, p); err == nil {
+		t.Fatal("bad signature should fail")
+	}
+}
@@ -0,0 +1,601 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 内置的构建流程，与构建脚本 builder.sh 的步骤一致，但直接使用已加载的项目配置与系统配置
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pkg/tcw.im/rtfd/assets"
+	"pkg/tcw.im/rtfd/pkg/conf"
+	"pkg/tcw.im/rtfd/pkg/lib"
+	"pkg/tcw.im/rtfd/pkg/util"
+
+	"pkg.tcw.im/gtc"
+)
+
+// 源码仓库中的项目规则文件
+const projectINI = ".rtfd.ini"
+
+// errAborted 构建已超时或被取消
+var errAborted = errors.New("build aborted")
+
+// pipeline 内置构建流程
+type pipeline struct {
+	r   *runner
+	cfg *conf.Config
+	// 项目配置，已合并规则文件中的构建时参数
+	opt lib.Options
+	// 源码目录
+	repo string
+	// 虚拟环境目录
+	venv string
+	// 虚拟环境是否复用自缓存
+	cached bool
+	// 构建结束前一直持有的文件锁
+	locks []*os.File
+	st    buildStatus
+}
+
+func newPipeline(r *runner, opt lib.Options) *pipeline {
+	return &pipeline{
+		r: r, cfg: r.b.pm.CFG(), opt: opt,
+		repo: filepath.Join(r.runtime, opt.Name),
+		st:   buildStatus{Code: -1, Usedtime: -1},
+	}
+}
+
+// execute 依次执行各构建步骤，任一步骤失败即停止
+func (p *pipeline) execute() buildStatus {
+	defer func() {
+		for _, l := range p.locks {
+			l.Close()
+		}
+	}()
+	begin := time.Now()
+	p.r.printf(
+		"Run a build for %s:%s with rtfd %s at %s\n",
+		p.opt.Name, p.r.task.Branch, strings.TrimSpace(assets.AppVersion),
+		begin.Format("2006-01-02T15:04:05"),
+	)
+
+	type step struct {
+		name string
+		fn   func() error
+	}
+	steps := []step{{StepClone, p.clone}, {StepVenv, p.createVenv}, {StepPip, p.install}}
+	if p.opt.BeforeHook != "" {
+		steps = append(steps, step{StepHook, p.beforeHook})
+	}
+	for _, s := range steps {
+		if !p.step(s.name, s.fn) {
+			return p.st
+		}
+	}
+	// 文档引擎可由规则文件指定，克隆后才能确定
+	docs := step{StepSphinx, p.sphinx}
+	if p.opt.IsCustom() {
+		docs = step{StepCustom, p.custom}
+	} else if p.opt.IsMkDocs() {
+		docs = step{StepMkDocs, p.mkdocs}
+	}
+	if !p.step(docs.name, docs.fn) {
+		return p.st
+	}
+	// 下载格式在HTML发布之后构建，失败时仅记录，不影响已发布的文档
+	if docs.name == StepSphinx && len(p.opt.FormatList()) > 0 {
+		p.optionalStep(StepFormats, p.formats)
+	}
+
+	p.afterHook()
+	p.updateProject()
+
+	p.st.Done = true
+	p.st.Code = 0
+	p.st.Usedtime = int(time.Since(begin).Seconds())
+	p.r.printf("Build Successfully, %d seconds passed.\n", p.st.Usedtime)
+	return p.st
+}
+
+// step 执行一个步骤并记录其结果
+func (p *pipeline) step(name string, fn func() error) bool {
+	if p.r.aborted() {
+		p.st.FailedStep = name
+		return false
+	}
+	begin := time.Now()
+	return p.record(name, false, begin, fn())
+}
+
+// optionalStep 执行一个可失败的步骤并记录其结果，失败不会使构建失败
+func (p *pipeline) optionalStep(name string, fn func() error) {
+	if p.r.aborted() {
+		return
+	}
+	begin := time.Now()
+	p.record(name, true, begin, fn())
+}
+
+// record 记录步骤结果，非可选步骤失败时记录失败步骤与退出码
+func (p *pipeline) record(name string, optional bool, begin time.Time, err error) bool {
+	sr := lib.StepResult{
+		Name: name, Status: err == nil, Usedtime: int(time.Since(begin).Seconds()),
+	}
+	if err != nil {
+		sr.Error = err.Error()
+	}
+	p.st.Steps = append(p.st.Steps, sr)
+	if err == nil {
+		return true
+	}
+	if optional {
+		p.r.printf("Step %s failed (ignored): %s\n", name, err)
+		return false
+	}
+	p.st.FailedStep = name
+	p.st.Code = util.ExitCode(err)
+	if p.st.Code <= 0 {
+		p.st.Code = 1
+	}
+	p.r.printf("Step %s failed: %s\n", name, err)
+	return false
+}
+
+// output 在 dir 目录中运行命令并返回其标准输出
+func (p *pipeline) output(dir string, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// env 构建命令的环境变量：激活虚拟环境，并导出项目的构建环境变量
+func (p *pipeline) env() []string {
+	env := os.Environ()
+	if p.venv != "" {
+		bin := filepath.Join(p.venv, "bin")
+		env = append(
+			env,
+			"VIRTUAL_ENV="+p.venv,
+			"PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"),
+		)
+	}
+	return append(env, p.r.env...)
+}
+
+// clone 由项目缓存中的git镜像仓库克隆指定分支代码，并合并仓库中规则文件的构建时参数
+func (p *pipeline) clone() error {
+	if p.opt.URL == "" {
+		return errors.New("empty git url")
+	}
+	cache := p.r.b.pm.CacheDir(p.opt.Name)
+	if err := os.MkdirAll(cache, 0755); err != nil {
+		return err
+	}
+	// 同一项目的多个构建不能同时更新镜像仓库
+	lock, err := util.Lock(filepath.Join(cache, ".lock"))
+	if err != nil {
+		return err
+	}
+	mirror := filepath.Join(cache, mirrorName)
+	err = p.updateMirror(mirror)
+	if err == nil {
+		err = p.git(
+			p.r.runtime, "clone", "--branch", p.r.task.Branch, "--single-branch",
+			mirror, p.opt.Name,
+		)
+	}
+	lock.Close()
+	if err != nil {
+		return err
+	}
+
+	// 子模块的相对地址需以项目地址为准
+	if err := p.git(p.repo, "remote", "set-url", "origin", p.opt.URL); err != nil {
+		return err
+	}
+	if err := p.git(p.repo, "submodule", "update", "--init", "--recursive", "--depth=1"); err != nil {
+		return err
+	}
+
+	out, err := p.output(p.repo, "git", "log", "-1", "--format=%H%n%an%n%cI%n%s")
+	if err != nil {
+		return err
+	}
+	info := strings.SplitN(out, "\n", 4)
+	if len(info) != 4 {
+		return fmt.Errorf("invalid commit info: %s", out)
+	}
+	p.st.Commit, p.st.CommitAuthor, p.st.CommitTime, p.st.CommitSubject = info[0], info[1], info[2], info[3]
+	p.r.printf("Checkout commit %s\n", p.st.Commit)
+
+	return p.loadINI()
+}
+
+// loadINI 读取项目规则文件，其构建时参数优先级高于系统存储配置
+func (p *pipeline) loadINI() error {
+	file := filepath.Join(p.repo, projectINI)
+	if !gtc.IsFile(file) {
+		return nil
+	}
+	ini, err := conf.New(file)
+	if err != nil {
+		return err
+	}
+	if v := ini.GetKey("project", "latest"); v != "" {
+		p.opt.Latest = v
+	}
+	if v := ini.GetKey("project", "engine"); v != "" {
+		p.opt.Engine = lib.Engine(strings.ToLower(v))
+	}
+	if v := ini.GetKey("sphinx", "sourcedir"); v != "" {
+		p.opt.SourceDir = v
+	}
+	if v := ini.GetKey("sphinx", "lang"); v != "" {
+		p.opt.Lang = v
+	}
+	if v := ini.GetKey("sphinx", "builder"); v != "" {
+		p.opt.Builder = lib.BuilderType(v)
+	}
+	if v := ini.GetKey("sphinx", "fail_on_warning"); v != "" {
+		p.opt.FailOnWarning = gtc.IsTrue(v)
+	}
+	if v := ini.GetKey("sphinx", "formats"); v != "" {
+		if err := lib.CheckFormats(v); err != nil {
+			return err
+		}
+		p.opt.Formats = v
+	}
+	if v := ini.GetKey("python", "version"); v != "" {
+		p.opt.Version = lib.PyVer(v)
+	}
+	if v := ini.GetKey("custom", "command"); v != "" {
+		p.opt.Command = v
+	}
+	if v := ini.GetKey("custom", "output"); v != "" {
+		p.opt.OutputDir = v
+	}
+	if v := ini.GetKey("python", "requirement"); v != "" {
+		p.opt.Requirement = v
+	}
+	if v := ini.GetKey("python", "install"); v != "" {
+		p.opt.Install = gtc.IsTrue(v)
+	}
+	if v := ini.GetKey("python", "index"); v != "" {
+		p.opt.Index = v
+	}
+	return nil
+}
+
+// checkPath 检测相对于源码目录的路径，清理后不能跳出源码目录，避免安全风险
+func checkPath(field, path string) error {
+	if _, ok := util.SubPath(path); !ok {
+		return fmt.Errorf("In %s, %s must be a relative path inside the project", projectINI, field)
+	}
+	return nil
+}
+
+// skipPython 自定义构建器未声明Python依赖时无需虚拟环境
+func (p *pipeline) skipPython() bool {
+	return p.opt.IsCustom() && strings.TrimSpace(p.opt.Requirement) == "" && !p.opt.Install
+}
+
+// requirements 依赖包需求文件列表
+func (p *pipeline) requirements() (reqs []string, err error) {
+	for _, req := range strings.Split(p.opt.Requirement, ",") {
+		req = strings.TrimSpace(req)
+		if req == "" {
+			continue
+		}
+		if err = checkPath("requirement", req); err != nil {
+			return
+		}
+		reqs = append(reqs, req)
+	}
+	return
+}
+
+// createVenv 创建虚拟环境，Python与依赖文件未变化时复用缓存的虚拟环境
+func (p *pipeline) createVenv() error {
+	if p.skipPython() {
+		p.r.printf("No python requirements, skip virtualenv\n")
+		return nil
+	}
+	py, err := p.r.b.pm.PyPath(p.opt.Version)
+	if err != nil {
+		return err
+	}
+	if _, err := exec.LookPath(py); err != nil {
+		return err
+	}
+	reqs, err := p.requirements()
+	if err != nil {
+		return err
+	}
+	key, err := venvKey(p.repo, py, string(p.opt.Version), reqs)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(p.r.b.pm.CacheDir(p.opt.Name), venvsName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// 使用同一虚拟环境的构建依次进行
+	lock, err := util.Lock(filepath.Join(dir, key+".lock"))
+	if err != nil {
+		return err
+	}
+	p.locks = append(p.locks, lock)
+
+	p.venv = filepath.Join(dir, key)
+	ready := filepath.Join(p.venv, venvReady)
+	if gtc.IsFile(ready) {
+		now := time.Now()
+		os.Chtimes(ready, now, now)
+		p.cached = true
+		p.r.printf("Reuse virtualenv %s\n", key)
+		return nil
+	}
+	pruneVenvs(dir, key)
+	os.RemoveAll(p.venv)
+	return p.r.run(dir, nil, py, "-m", "virtualenv", key)
+}
+
+// install 安装依赖（必须自行将sphinx写入依赖包文件），复用的虚拟环境仅需安装项目
+func (p *pipeline) install() error {
+	if p.skipPython() {
+		return nil
+	}
+	index := p.opt.Index
+	if index == "" {
+		index = p.cfg.MustKey("py", "index", "https://pypi.org/simple")
+	}
+	py := filepath.Join(p.venv, "bin", "python")
+	if !p.cached {
+		reqs, err := p.requirements()
+		if err != nil {
+			return err
+		}
+		for _, req := range reqs {
+			err := p.r.run(p.repo, p.env(), py, "-m", "pip", "install", "-i", index, "-r", req)
+			if err != nil {
+				return err
+			}
+		}
+		if err := os.WriteFile(filepath.Join(p.venv, venvReady), nil, 0644); err != nil {
+			return err
+		}
+	}
+	if p.opt.Install {
+		return p.r.run(p.repo, p.env(), py, "-m", "pip", "install", "-i", index, ".")
+	}
+	return nil
+}
+
+// beforeHook 执行构建前的钩子命令
+func (p *pipeline) beforeHook() error {
+	p.r.printf("Trigger before_hook: %s\n", p.opt.BeforeHook)
+	return p.r.run(p.repo, p.env(), "bash", "-c", p.opt.BeforeHook)
+}
+
+// afterHook 执行构建成功后的钩子命令，其失败不影响构建结果
+func (p *pipeline) afterHook() {
+	if p.opt.AfterHook == "" {
+		return
+	}
+	p.r.printf("Trigger after_hook: %s\n", p.opt.AfterHook)
+	if err := p.r.run(p.repo, p.env(), "bash", "-c", p.opt.AfterHook); err != nil {
+		p.r.printf("after_hook fail: %s\n", err)
+	} else {
+		p.r.printf("after_hook ok\n")
+	}
+}
+
+// jsURL rtfd.js 的引用地址，其查询参数为文档导航所需信息
+func (p *pipeline) jsURL() string {
+	server := p.cfg.GetKey("api", "server_url")
+	static := p.cfg.MustKey("api", "server_static_url", server+"/rtfd/assets/")
+	return fmt.Sprintf(
+		"%srtfd.js?v=%s&name=%s&branch=%s&rtfd_api=%s",
+		static, strings.TrimSpace(assets.AppVersion), p.opt.Name, p.r.task.Branch, server,
+	)
+}
+
+// favicon 文档图标地址
+func (p *pipeline) favicon() string {
+	return p.cfg.MustKey(
+		"default", "favicon_url", "https://static.saintic.com/rtfd/favicon.png",
+	)
+}
+
+// injectMode 实际的注入方式，自定义构建器没有文档配置，只能插入HTML
+func (p *pipeline) injectMode() lib.InjectMode {
+	mode := p.opt.Inject
+	if mode == "" || (mode == lib.InjectConf && p.opt.IsCustom()) {
+		mode = lib.InjectHTML
+	}
+	return mode
+}
+
+// injectConf 向 sphinx 配置文件追加 rtfd.js 与 favicon 配置
+func (p *pipeline) injectConf() error {
+	confpy := filepath.Join(p.repo, p.opt.SourceDir, "conf.py")
+	if !gtc.IsFile(confpy) {
+		return fmt.Errorf("Not found docs conf.py in %s", filepath.Join(p.repo, p.opt.SourceDir))
+	}
+	text := fmt.Sprintf(`
+#: Automatic generated by rtfd at %s
+if not 'html_js_files' in globals():
+    html_js_files = []
+html_js_files.append("%s")
+if 'html_favicon' not in globals():
+    html_favicon = '%s'
+`,
+		util.GetNow(), p.jsURL(), p.favicon(),
+	)
+	fd, err := os.OpenFile(confpy, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	_, err = fd.WriteString(text)
+	return err
+}
+
+// sphinx 使用 sphinx-build 构建文档
+func (p *pipeline) sphinx() error {
+	if err := checkPath("sourcedir", p.opt.SourceDir); err != nil {
+		return err
+	}
+	if p.injectMode() == lib.InjectConf {
+		if err := p.injectConf(); err != nil {
+			return err
+		}
+	}
+	builder := string(p.opt.Builder)
+	if builder == "" {
+		builder = string(lib.HTMLBuilder)
+	}
+	err := p.buildLangs(func(lang, out string) error {
+		// 警告写入文件以便统计，无论构建成功与否
+		wf := filepath.Join(p.r.runtime, "warnings-"+lang+".log")
+		args := []string{"-w", wf}
+		if p.opt.FailOnWarning {
+			args = append(args, "-W", "--keep-going")
+		}
+		err := p.sphinxBuild(lang, builder, out, args...)
+		// 警告会公开在项目信息中，需遮蔽环境变量值并隐藏构建主机上的路径
+		paths := []pathAlias{
+			{p.repo, ""}, {p.venv, "$VIRTUAL_ENV"}, {p.r.runtime, "$RUNTIME"},
+			{p.cfg.BaseDir(), "$BASEDIR"},
+		}
+		for _, w := range parseWarnings(wf) {
+			p.st.Warnings = append(p.st.Warnings, p.r.mask(cleanPaths(w, paths)))
+		}
+		return err
+	})
+	if n := len(p.st.Warnings); n > 0 {
+		p.r.printf("Sphinx build reported %d warnings\n", n)
+	}
+	return err
+}
+
+// buildLangs 按语言构建文档，发布后更新 latest 链接。
+// 先输出到暂存目录，全部语言构建成功后再发布，失败则保留原有版本。
+// 注入方式为html时，在发布前向生成的HTML文件插入 rtfd.js 与 favicon。
+func (p *pipeline) buildLangs(build func(lang, out string) error) error {
+	if p.injectMode() == lib.InjectHTML {
+		build = p.withInjectHTML(build)
+	}
+	docs := filepath.Join(p.cfg.BaseDir(), "docs", p.opt.Name)
+	branch, id := p.r.task.Branch, p.r.task.ID
+
+	var dirs []string
+	for _, lang := range strings.Split(p.opt.Lang, ",") {
+		lang = strings.TrimSpace(lang)
+		if lang == "" {
+			continue
+		}
+		dir := filepath.Join(docs, lang)
+		dirs = append(dirs, dir)
+		if err := build(lang, stagingDir(dir, branch, id)); err != nil {
+			discardStaging(dirs, branch, id)
+			return err
+		}
+	}
+	// 仅发布标签时更新 stable，以远程仓库的引用区分标签与分支
+	isTag := map[string]bool{}
+	if util.IsSemver(branch) {
+		isTag = p.r.b.tags(p.opt)
+	}
+	for i, dir := range dirs {
+		// 超时或被取消的构建不再发布
+		if p.r.aborted() {
+			return p.publishFailed(dirs, i, errAborted)
+		}
+		if err := publish(dir, branch, id); err != nil {
+			return p.publishFailed(dirs, i, err)
+		}
+		if p.r.aborted() {
+			return p.publishFailed(dirs, i+1, errAborted)
+		}
+		if err := swapSymlink(filepath.Join(dir, p.opt.Latest), filepath.Join(dir, "latest"), id); err != nil {
+			return p.publishFailed(dirs, i+1, err)
+		}
+		if isTag[branch] {
+			if err := updateStable(p.opt, dir, isTag); err != nil {
+				return p.publishFailed(dirs, i+1, err)
+			}
+		}
+	}
+	// 首次发布某个语言的版本时为其创建别名链接
+	return p.r.b.linkAliases(p.opt)
+}
+
+// publishFailed 发布中途失败时删除未发布语言的暂存目录，
+// 前 published 个语言已切换到本次构建时记为部分发布
+func (p *pipeline) publishFailed(dirs []string, published int, err error) error {
+	discardStaging(dirs[published:], p.r.task.Branch, p.r.task.ID)
+	if published == 0 {
+		return err
+	}
+	p.st.Partial = true
+	return fmt.Errorf("published %d of %d languages: %w", published, len(dirs), err)
+}
+
+// withInjectHTML 构建完成后向生成的HTML文件插入 rtfd.js 与 favicon
+func (p *pipeline) withInjectHTML(build func(lang, out string) error) func(lang, out string) error {
+	script := fmt.Sprintf(`<script src="%s"></script>`, html.EscapeString(p.jsURL()))
+	favicon := fmt.Sprintf(`<link rel="icon" href="%s">`, html.EscapeString(p.favicon()))
+	return func(lang, out string) error {
+		if err := build(lang, out); err != nil {
+			return err
+		}
+		return injectHTML(out, script, favicon)
+	}
+}
+
+// updateProject 依照规则文件更新项目配置
+func (p *pipeline) updateProject() {
+	file := filepath.Join(p.repo, projectINI)
+	if !gtc.IsFile(file) {
+		return
+	}
+	opt, err := p.r.b.pm.GetName(p.opt.Name)
+	if err != nil {
+		p.r.printf("update project from %s failed: %s\n", projectINI, err)
+		return
+	}
+	ok, fail, err := p.r.b.pm.UpdateFromFile(&opt, file)
+	if err == lib.ErrNotUpdated {
+		return
+	}
+	if err != nil {
+		p.r.printf("update project from %s failed: %s\n", projectINI, err)
+		return
+	}
+	p.r.printf("updated, ok: %s; fail: %s\n", strings.Join(ok, ", "), strings.Join(fail, ", "))
+}
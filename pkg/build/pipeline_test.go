@@ -0,0 +1,98 @@
+package build
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+)
+
+func TestLoadINI(t *testing.T) {
+	repo := t.TempDir()
+	p := &pipeline{repo: repo, opt: lib.Options{Latest: "master", Lang: "en", Install: true}}
+
+	// 没有规则文件时保持原配置
+	if err := p.loadINI(); err != nil || p.opt.Latest != "master" {
+		t.Fatalf("load without ini error: %v, %+v", err, p.opt)
+	}
+
+	ini := `[project]
+latest = dev
+engine = MkDocs
+
+[sphinx]
+sourcedir = doc
+lang = zh_CN,en
+builder = dirhtml
+fail_on_warning = true
+formats = pdf,epub
+
+[python]
+version = 2
+requirement = requirements/docs.txt
+install = false
+`
+	os.WriteFile(filepath.Join(repo, projectINI), []byte(ini), 0644)
+	if err := p.loadINI(); err != nil {
+		t.Fatal(err)
+	}
+	o := p.opt
+	if o.Latest != "dev" || o.Engine != lib.MkDocsEngine || o.SourceDir != "doc" ||
+		o.Lang != "zh_CN,en" || o.Builder != lib.BuilderType("dirhtml") || !o.FailOnWarning ||
+		o.Formats != "pdf,epub" || o.Version != lib.PyVer("2") ||
+		o.Requirement != "requirements/docs.txt" || o.Install {
+		t.Fatalf("load ini error: %+v", o)
+	}
+
+	os.WriteFile(filepath.Join(repo, projectINI), []byte("[sphinx]\nformats = pdf,doc\n"), 0644)
+	if err := p.loadINI(); err == nil {
+		t.Fatal("should raise error for invalid formats")
+	}
+}
+
+func TestStepRecord(t *testing.T) {
+	p := &pipeline{r: &runner{out: func(string) {}}, st: buildStatus{Code: -1}}
+	begin := time.Now()
+
+	if !p.record(StepClone, false, begin, nil) {
+		t.Fatal("successful step should continue")
+	}
+	p.record(StepFormats, true, begin, errors.New("no latex"))
+	if p.st.FailedStep != "" || p.st.Code != -1 {
+		t.Fatalf("optional step should not fail build: %+v", p.st)
+	}
+	if p.record(StepPip, false, begin, exec.Command("sh", "-c", "exit 3").Run()) {
+		t.Fatal("failed step should stop")
+	}
+	if p.st.FailedStep != StepPip || p.st.Code != 3 {
+		t.Fatalf("failed step status error: %+v", p.st)
+	}
+	// 非命令退出的错误，退出码记为1
+	p.record(StepSphinx, false, begin, errors.New("not found conf.py"))
+	if p.st.FailedStep != StepSphinx || p.st.Code != 1 {
+		t.Fatalf("error step status error: %+v", p.st)
+	}
+
+	s := p.st.Steps
+	if len(s) != 4 || !s[0].Status || s[0].Error != "" || s[1].Status || s[1].Error != "no latex" ||
+		s[2].Name != StepPip || s[2].Status || s[3].Error != "not found conf.py" {
+		t.Fatalf("step results error: %+v", s)
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	for _, path := range []string{"docs", "docs/source", "./build/html"} {
+		if err := checkPath("sourcedir", path); err != nil {
+			t.Fatalf("%s should be valid: %v", path, err)
+		}
+	}
+	for _, path := range []string{"", "/etc", "../docs", "docs/../..", "docs/../../x"} {
+		if err := checkPath("sourcedir", path); err == nil {
+			t.Fatalf("%s should be invalid", path)
+		}
+	}
+}
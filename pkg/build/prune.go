@@ -0,0 +1,135 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 文档版本的保留规则：标签按语义化版本号保留最新的若干个，分支超过一定天数未构建即删除
+
+package build
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+	"pkg/tcw.im/rtfd/pkg/util"
+)
+
+// version 已发布的文档版本
+type version struct {
+	name string
+	// 最近一次构建时间
+	built time.Time
+}
+
+// selectPrune 按保留规则选择要删除的版本：isTag 为远程仓库中的标签，保留最新的 keepTags 个
+// （语义化版本号按版本号，其他标签排在其后按构建时间）；其他视为分支，最近一次构建早于 maxAge 的删除。
+// latest 所指向的版本总是保留，规则为0表示不限制。
+func selectPrune(vs []version, isTag map[string]bool, latest string, keepTags int, maxAge time.Duration, now time.Time) (prune []string) {
+	var tags []version
+	for _, v := range vs {
+		if v.name == latest {
+			continue
+		}
+		if isTag[v.name] {
+			tags = append(tags, v)
+		} else if maxAge > 0 && !v.built.IsZero() && now.Sub(v.built) > maxAge {
+			prune = append(prune, v.name)
+		}
+	}
+	if keepTags > 0 && len(tags) > keepTags {
+		sort.Slice(tags, func(i, j int) bool {
+			a, b := tags[i], tags[j]
+			if util.IsSemver(a.name) || util.IsSemver(b.name) {
+				return util.CompareSemver(a.name, b.name) > 0
+			}
+			return a.built.After(b.built)
+		})
+		for _, v := range tags[keepTags:] {
+			prune = append(prune, v.name)
+		}
+	}
+	sort.Strings(prune)
+	return
+}
+
+// remoteTags 远程仓库中的标签（不含同名的分支），同时保存供API等不访问远程仓库的场景使用
+func (b *Builder) remoteTags(opt lib.Options) (map[string]bool, error) {
+	branches, tags, err := util.GitRemoteRefs(opt.URL)
+	if err != nil {
+		return nil, err
+	}
+	isTag := make(map[string]bool)
+	for _, t := range tags {
+		isTag[t] = true
+	}
+	for _, b := range branches {
+		delete(isTag, b)
+	}
+	names := make([]string, 0, len(isTag))
+	for t := range isTag {
+		names = append(names, t)
+	}
+	b.pm.SetTags(opt.Name, names)
+	return isTag, nil
+}
+
+// tags 区分文档版本是标签还是分支，无法访问远程仓库时使用最近一次保存的标签
+func (b *Builder) tags(opt lib.Options) map[string]bool {
+	if isTag, err := b.remoteTags(opt); err == nil {
+		return isTag
+	}
+	isTag, _ := b.pm.Tags(opt.Name)
+	return isTag
+}
+
+// Prune 按项目的保留规则删除文档版本，包括各语言的文档、下载文件与构建结果，
+// dryRun 为 true 时仅返回将被删除的版本
+func (b *Builder) Prune(name string, dryRun bool) ([]string, error) {
+	name = strings.ToLower(name)
+	opt, err := b.pm.GetName(name)
+	if err != nil {
+		return nil, err
+	}
+	if opt.Single || (opt.KeepTags <= 0 && opt.BranchMaxAge <= 0) {
+		return nil, nil
+	}
+	vs, err := b.versions(opt)
+	if err != nil {
+		return nil, err
+	}
+	// 以远程仓库的引用区分标签与分支，不能仅凭名称判断（如 release-2021 是标签、2021 是分支）
+	isTag, err := b.remoteTags(opt)
+	if err != nil {
+		return nil, fmt.Errorf("list remote refs failed: %w", err)
+	}
+	maxAge := time.Duration(opt.BranchMaxAge) * 24 * time.Hour
+	prune := selectPrune(vs, isTag, opt.Latest, opt.KeepTags, maxAge, time.Now())
+	if dryRun {
+		return prune, nil
+	}
+	for _, v := range prune {
+		if err := b.removeVersion(&opt, v, isTag); err != nil {
+			return nil, err
+		}
+	}
+	if len(prune) > 0 {
+		if err := opt.Writeback(b.pm); err != nil {
+			return nil, err
+		}
+	}
+	return prune, nil
+}
@@ -0,0 +1,51 @@
+package build
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelectPrune(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	vs := []version{
+		{"master", now.Add(-100 * day)},
+		{"dev", now.Add(-2 * day)},
+		{"feature/x", now.Add(-40 * day)},
+		{"2021", now.Add(-50 * day)},
+		{"v1.0.0", now.Add(-300 * day)},
+		{"v1.2.0", now.Add(-200 * day)},
+		{"v1.10.0", now.Add(-100 * day)},
+		{"v2.0.0-rc.1", now.Add(-1 * day)},
+		{"release-2021", now.Add(-400 * day)},
+		{"release-2022", now.Add(-350 * day)},
+	}
+	// 2021 是分支，release-* 是标签
+	isTag := map[string]bool{
+		"v1.0.0": true, "v1.2.0": true, "v1.10.0": true, "v2.0.0-rc.1": true,
+		"release-2021": true, "release-2022": true,
+	}
+	cases := []struct {
+		keepTags int
+		maxAge   time.Duration
+		prune    string
+	}{
+		{0, 0, ""},
+		{5, 0, "release-2021"},
+		{3, 0, "release-2021,release-2022,v1.0.0"},
+		{0, 30 * day, "2021,feature/x"},
+		{1, 30 * day, "2021,feature/x,release-2021,release-2022,v1.0.0,v1.10.0,v1.2.0"},
+	}
+	for _, c := range cases {
+		got := strings.Join(selectPrune(vs, isTag, "master", c.keepTags, c.maxAge, now), ",")
+		if got != c.prune {
+			t.Fatalf("keep %d maxAge %s: got %s, want %s", c.keepTags, c.maxAge, got, c.prune)
+		}
+	}
+	// latest 指向的标签同样保留
+	got := selectPrune(vs, isTag, "v1.0.0", 1, 0, now)
+	if strings.Join(got, ",") != "release-2021,release-2022,v1.10.0,v1.2.0" {
+		t.Fatalf("latest should be kept, got %v", got)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 文档版本的发布：构建输出到暂存目录，全部语言构建成功后再以符号链接原子切换
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// stagingName 暂存目录名，位于各语言目录下，以 . 开头不会被当作文档版本
+const stagingName = ".builds"
+
+// stagingDir 构建输出的暂存目录，即 <lang>/.builds/<branch>/<id>
+func stagingDir(langDir, branch, id string) string {
+	return filepath.Join(langDir, stagingName, branch, id)
+}
+
+// discardStaging 删除各语言中本次构建未发布的暂存目录
+func discardStaging(langDirs []string, branch, id string) {
+	for _, dir := range langDirs {
+		target := stagingDir(dir, branch, id)
+		if cur, err := os.Readlink(filepath.Join(dir, branch)); err == nil && cur == target {
+			continue
+		}
+		os.RemoveAll(target)
+	}
+}
+
+// swapSymlink 将 link 指向 target，已存在时原子替换：
+// 先创建临时链接（以 suffix 区分）再重命名覆盖原链接，访问者不会看到链接缺失
+func swapSymlink(target, link, suffix string) error {
+	tmp := filepath.Join(filepath.Dir(link), "."+filepath.Base(link)+".tmp-"+suffix)
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// publish 将暂存目录发布为 <lang>/<branch>，并清理该分支旧的暂存目录。
+// 先创建临时链接再重命名覆盖原链接，访问者不会看到写了一半的文档。
+func publish(langDir, branch, id string) error {
+	target := stagingDir(langDir, branch, id)
+	link := filepath.Join(langDir, branch)
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return err
+	}
+
+	// 旧版本直接构建在 <lang>/<branch> 目录，先将其移入暂存目录以便替换
+	if fi, err := os.Lstat(link); err == nil && fi.IsDir() {
+		legacy := stagingDir(langDir, branch, "legacy")
+		os.RemoveAll(legacy)
+		if err := os.Rename(link, legacy); err != nil {
+			return err
+		}
+	}
+
+	if err := swapSymlink(target, link, id); err != nil {
+		return err
+	}
+
+	// 清理旧的暂存目录
+	ds, err := os.ReadDir(filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	for _, d := range ds {
+		if d.Name() != id {
+			os.RemoveAll(filepath.Join(filepath.Dir(target), d.Name()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPublish(t *testing.T) {
+	lang := filepath.Join(t.TempDir(), "en")
+
+	// 旧版本直接构建在分支目录中
+	os.MkdirAll(filepath.Join(lang, "master"), 0755)
+	os.WriteFile(filepath.Join(lang, "master", "index.html"), []byte("v0"), 0644)
+
+	for _, id := range []string{"1", "2"} {
+		dir := stagingDir(lang, "master", id)
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "index.html"), []byte("v"+id), 0644)
+		if err := publish(lang, "master", id); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(lang, "master", "index.html"))
+		if err != nil || string(data) != "v"+id {
+			t.Fatalf("publish %s error: %s, %v", id, data, err)
+		}
+	}
+
+	ds, _ := os.ReadDir(filepath.Join(lang, stagingName, "master"))
+	if len(ds) != 1 || ds[0].Name() != "2" {
+		t.Fatalf("old staging directories should be removed: %v", ds)
+	}
+}
+
+func TestDiscardStaging(t *testing.T) {
+	root := t.TempDir()
+	en, zh := filepath.Join(root, "en"), filepath.Join(root, "zh")
+	for _, lang := range []string{en, zh} {
+		os.MkdirAll(stagingDir(lang, "master", "1"), 0755)
+	}
+	// en 已发布，zh 发布失败
+	if err := publish(en, "master", "1"); err != nil {
+		t.Fatal(err)
+	}
+	discardStaging([]string{en, zh}, "master", "1")
+	if _, err := os.Stat(stagingDir(en, "master", "1")); err != nil {
+		t.Fatal("published staging dir should be kept")
+	}
+	if _, err := os.Stat(stagingDir(zh, "master", "1")); !os.IsNotExist(err) {
+		t.Fatal("unpublished staging dir should be removed")
+	}
+}
@@ -0,0 +1,91 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 批量构建：按条件选择远程仓库的分支与标签
+
+package build
+
+import (
+	"errors"
+	"path"
+
+	"pkg/tcw.im/rtfd/pkg/util"
+)
+
+// RefFilter 批量构建时选择远程分支与标签的条件，多个条件的结果取并集
+type RefFilter struct {
+	// 全部分支
+	AllBranches bool
+	// 名称匹配的标签（glob模式，如 v*）
+	Tags string
+	// 名称匹配的分支或标签（glob模式）
+	Match string
+}
+
+// IsEmpty 是否未设置任何条件
+func (f RefFilter) IsEmpty() bool {
+	return !f.AllBranches && f.Tags == "" && f.Match == ""
+}
+
+// filter 从分支与标签中选择符合条件的，分支在前，同名的仅保留一个
+func (f RefFilter) filter(branches, tags []string) (refs []string, err error) {
+	for _, pat := range []string{f.Tags, f.Match} {
+		if pat == "" {
+			continue
+		}
+		if _, err = path.Match(pat, ""); err != nil {
+			return
+		}
+	}
+	seen := make(map[string]bool)
+	add := func(ref string) {
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	match := func(pat, ref string) bool {
+		ok, _ := path.Match(pat, ref)
+		return pat != "" && ok
+	}
+	for _, b := range branches {
+		if f.AllBranches || match(f.Match, b) {
+			add(b)
+		}
+	}
+	for _, t := range tags {
+		if match(f.Tags, t) || match(f.Match, t) {
+			add(t)
+		}
+	}
+	return
+}
+
+// MatchRefs 列出项目远程仓库中符合条件的分支与标签
+func (b *Builder) MatchRefs(name string, f RefFilter) ([]string, error) {
+	if f.IsEmpty() {
+		return nil, errors.New("no ref filter")
+	}
+	opt, err := b.pm.GetName(name)
+	if err != nil {
+		return nil, err
+	}
+	branches, tags, err := util.GitRemoteRefs(opt.URL)
+	if err != nil {
+		return nil, err
+	}
+	return f.filter(branches, tags)
+}
@@ -0,0 +1,37 @@
+package build
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRefFilter(t *testing.T) {
+	branches := []string{"master", "dev", "release/1.x"}
+	tags := []string{"v1.0", "v1.1", "1.x", "dev"}
+	cases := []struct {
+		f    RefFilter
+		refs string
+	}{
+		{RefFilter{AllBranches: true}, "master,dev,release/1.x"},
+		{RefFilter{Tags: "v*"}, "v1.0,v1.1"},
+		{RefFilter{Match: "*1.x"}, "1.x"},
+		{RefFilter{Match: "release/*"}, "release/1.x"},
+		{RefFilter{AllBranches: true, Tags: "*"}, "master,dev,release/1.x,v1.0,v1.1,1.x"},
+		{RefFilter{Tags: "none*"}, ""},
+	}
+	for _, c := range cases {
+		refs, err := c.f.filter(branches, tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(refs, ",") != c.refs {
+			t.Fatalf("filter %+v error: %v", c.f, refs)
+		}
+	}
+	if _, err := (RefFilter{Match: "["}).filter(branches, tags); err == nil {
+		t.Fatal("should raise error for bad pattern")
+	}
+	if !(RefFilter{}).IsEmpty() {
+		t.Fatal("empty filter error")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 构建脚本与rtfd之间的状态协议：脚本向状态文件逐行写入JSON格式的步骤事件
+
+package build
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+)
+
+// 构建步骤
+const (
+	StepClone  = "clone"
+	StepVenv   = "venv"
+	StepPip    = "pip"
+	StepSphinx = "sphinx"
+	StepMkDocs = "mkdocs"
+	StepCustom = "custom"
+	StepHook   = "hook"
+	// StepFormats 构建下载格式，失败不影响构建结果
+	StepFormats = "formats"
+	// StepDone 构建全部完成
+	StepDone = "done"
+)
+
+// 步骤事件类型
+const (
+	eventStart  = "start"
+	eventEnd    = "end"
+	eventFail   = "fail"
+	eventCommit = "commit"
+)
+
+// stepEvent 状态文件中的一条步骤事件
+type stepEvent struct {
+	Step     string `json:"step"`
+	Event    string `json:"event"`
+	Time     int64  `json:"time"`
+	Code     string `json:"code"`
+	SHA      string `json:"sha"`
+	Author   string `json:"author"`
+	Subject  string `json:"subject"`
+	Date     string `json:"date"`
+	Usedtime string `json:"usedtime"`
+}
+
+// buildStatus 由状态文件解析出的构建状态
+type buildStatus struct {
+	// 是否完成了全部步骤
+	Done bool
+	// 失败（或被中止）的步骤
+	FailedStep string
+	// 脚本报告的退出码，未报告时为-1
+	Code int
+	// 构建所用的git提交及其作者、说明与时间
+	Commit        string
+	CommitAuthor  string
+	CommitSubject string
+	CommitTime    string
+	// 脚本统计的构建时间（秒），未报告时为-1
+	Usedtime int
+	// 已结束（成功或失败）的各步骤结果
+	Steps []lib.StepResult
+	// Sphinx构建的警告与错误
+	Warnings []string
+	// 部分语言已发布本次构建，其余语言发布失败
+	Partial bool
+}
+
+// parseStatus 解析状态文件，无法识别的行会被忽略
+func parseStatus(path string) (st buildStatus, err error) {
+	st = buildStatus{Code: -1, Usedtime: -1}
+	fd, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+
+	running := ""
+	begins := make(map[string]int64)
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		var e stepEvent
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		switch e.Event {
+		case eventStart:
+			running = e.Step
+			begins[e.Step] = e.Time
+		case eventEnd:
+			if e.Step == StepDone {
+				st.Done = true
+				if n, err := strconv.Atoi(e.Usedtime); err == nil {
+					st.Usedtime = n
+				}
+			}
+			if e.Step == running {
+				running = ""
+			}
+			if b, ok := begins[e.Step]; ok {
+				st.Steps = append(st.Steps, lib.StepResult{
+					Name: e.Step, Status: true, Usedtime: int(e.Time - b),
+				})
+			}
+		case eventFail:
+			st.FailedStep = e.Step
+			if n, err := strconv.Atoi(e.Code); err == nil {
+				st.Code = n
+			}
+			sr := lib.StepResult{Name: e.Step, Error: fmt.Sprintf("exit code %s", e.Code)}
+			if b, ok := begins[e.Step]; ok {
+				sr.Usedtime = int(e.Time - b)
+			}
+			st.Steps = append(st.Steps, sr)
+		case eventCommit:
+			st.Commit = e.SHA
+			st.CommitAuthor = e.Author
+			st.CommitSubject = e.Subject
+			st.CommitTime = e.Date
+		}
+	}
+	// 进程被强制终止时没有失败事件，以最后一个未结束的步骤为准
+	if st.FailedStep == "" && !st.Done {
+		st.FailedStep = running
+	}
+	return st, scanner.Err()
+}
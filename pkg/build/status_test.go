@@ -0,0 +1,53 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseStatus(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "status")
+
+	_, err := parseStatus(f)
+	if err == nil {
+		t.Fatal("should raise error for missing file")
+	}
+
+	data := `{"step":"clone","event":"start","time":1}
+{"step":"clone","event":"commit","time":1,"sha":"abc123","author":"staugur","subject":"fix \"docs\"","date":"2021-01-01T00:00:00+08:00"}
+{"step":"clone","event":"end","time":2}
+Build Successfully, 3 seconds passed.
+{"step":"pip","event":"start","time":2}
+{"step":"pip","event":"fail","time":3,"code":"128"}
+`
+	os.WriteFile(f, []byte(data), 0644)
+	st, err := parseStatus(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Done || st.FailedStep != StepPip || st.Code != 128 || st.Commit != "abc123" ||
+		st.CommitAuthor != "staugur" || st.CommitSubject != `fix "docs"` {
+		t.Fatalf("parse failed status error: %+v", st)
+	}
+	if len(st.Steps) != 2 || !st.Steps[0].Status || st.Steps[0].Usedtime != 1 ||
+		st.Steps[1].Name != StepPip || st.Steps[1].Status {
+		t.Fatalf("parse steps error: %+v", st.Steps)
+	}
+
+	// 被强制终止，没有失败事件
+	os.WriteFile(f, []byte(`{"step":"sphinx","event":"start","time":1}`), 0644)
+	st, _ = parseStatus(f)
+	if st.Done || st.FailedStep != StepSphinx || st.Code != -1 {
+		t.Fatalf("parse killed status error: %+v", st)
+	}
+
+	os.WriteFile(f, []byte(`{"step":"sphinx","event":"start","time":1}
+{"step":"sphinx","event":"end","time":5}
+{"step":"done","event":"end","time":5,"usedtime":"4"}
+`), 0644)
+	st, _ = parseStatus(f)
+	if !st.Done || st.FailedStep != "" || st.Usedtime != 4 {
+		t.Fatalf("parse done status error: %+v", st)
+	}
+}
@@ -0,0 +1,411 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 文档版本管理：列出、删除、隐藏已发布的文档版本，以及为版本设置别名
+
+package build
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+	"pkg/tcw.im/rtfd/pkg/util"
+
+	"pkg.tcw.im/gtc"
+)
+
+// stableName 自动维护的链接名，指向版本号最大的正式版本
+const stableName = "stable"
+
+// VersionInfo 已发布的文档版本信息
+type VersionInfo struct {
+	// 版本名，即分支、标签或别名
+	Name string
+	// 已发布的语言
+	Langs []string
+	// 文档占用空间（字节），别名为0
+	Size int64
+	// 最近一次构建状态
+	State lib.BuildState
+	// 最近一次构建完成时间
+	Btime string
+	// 是否为 latest 所指向的版本
+	Latest bool
+	// 是否已隐藏
+	Hidden bool
+	// 别名所指向的版本，非别名时为空
+	Target string
+}
+
+// langDirs 项目各语言的文档目录
+func (b *Builder) langDirs(opt lib.Options) map[string]string {
+	dirs := make(map[string]string)
+	for _, lang := range strings.Split(opt.Lang, ",") {
+		lang = strings.TrimSpace(lang)
+		if lang != "" {
+			dirs[lang] = filepath.Join(b.pm.CFG().BaseDir(), "docs", opt.Name, lang)
+		}
+	}
+	return dirs
+}
+
+// versions 列出项目已发布的文档版本（不含别名），即有构建结果的分支及各语言目录下的版本
+func (b *Builder) versions(opt lib.Options) ([]version, error) {
+	rsts, err := b.pm.ListBuildset(opt.Name)
+	if err != nil {
+		return nil, err
+	}
+	built := make(map[string]time.Time)
+	for _, rst := range rsts {
+		t := rst.Btime
+		if t == "" {
+			t = rst.Stime
+		}
+		built[rst.Branch], _ = time.ParseInLocation(timeLayout, t, time.Local)
+	}
+	for _, langDir := range b.langDirs(opt) {
+		ds, err := os.ReadDir(langDir)
+		if err != nil {
+			continue
+		}
+		for _, d := range ds {
+			v := d.Name()
+			if _, ok := built[v]; ok || v == "latest" || strings.HasPrefix(v, ".") {
+				continue
+			}
+			if _, ok := opt.Aliases[v]; ok || isAutoStable(opt, langDir, v) {
+				continue
+			}
+			// 含 / 的分支位于子目录中，已由构建结果列出
+			nested := false
+			for known := range built {
+				if strings.HasPrefix(known, v+"/") {
+					nested = true
+					break
+				}
+			}
+			if nested {
+				continue
+			}
+			if fi, err := os.Lstat(filepath.Join(langDir, v)); err == nil {
+				built[v] = fi.ModTime()
+			}
+		}
+	}
+	vs := make([]version, 0, len(built))
+	for v, t := range built {
+		vs = append(vs, version{v, t})
+	}
+	return vs, nil
+}
+
+// Versions 列出项目已发布的文档版本及别名
+func (b *Builder) Versions(name string) ([]VersionInfo, error) {
+	opt, err := b.pm.GetName(strings.ToLower(name))
+	if err != nil {
+		return nil, err
+	}
+	vs, err := b.versions(opt)
+	if err != nil {
+		return nil, err
+	}
+	rsts, err := b.pm.ListBuildset(opt.Name)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]lib.Result)
+	for _, rst := range rsts {
+		results[rst.Branch] = rst
+	}
+	dirs := b.langDirs(opt)
+	infos := make([]VersionInfo, 0, len(vs)+len(opt.Aliases))
+	for _, v := range vs {
+		vi := VersionInfo{
+			Name: v.name, State: results[v.name].State, Btime: results[v.name].Btime,
+			Latest: v.name == opt.Latest, Hidden: opt.IsHidden(v.name),
+		}
+		for lang, dir := range dirs {
+			if !gtc.IsDir(filepath.Join(dir, v.name)) {
+				continue
+			}
+			vi.Langs = append(vi.Langs, lang)
+			vi.Size += dirSize(filepath.Join(dir, v.name))
+		}
+		sort.Strings(vi.Langs)
+		infos = append(infos, vi)
+	}
+	for alias, target := range opt.Aliases {
+		vi := VersionInfo{Name: alias, Target: target, Hidden: opt.IsHidden(alias)}
+		for lang, dir := range dirs {
+			if gtc.IsDir(filepath.Join(dir, alias)) {
+				vi.Langs = append(vi.Langs, lang)
+			}
+		}
+		sort.Strings(vi.Langs)
+		infos = append(infos, vi)
+	}
+	if _, ok := opt.Aliases[stableName]; !ok {
+		vi := VersionInfo{Name: stableName, Hidden: opt.IsHidden(stableName)}
+		for lang, dir := range dirs {
+			if target := stableTarget(opt, dir); target != "" {
+				vi.Langs = append(vi.Langs, lang)
+				vi.Target = target
+			}
+		}
+		if vi.Target != "" {
+			sort.Strings(vi.Langs)
+			infos = append(infos, vi)
+		}
+	}
+	names := make([]string, len(infos))
+	index := make(map[string]VersionInfo, len(infos))
+	for i, vi := range infos {
+		names[i] = vi.Name
+		index[vi.Name] = vi
+	}
+	util.SortVersions(names, b.tags(opt))
+	for i, name := range names {
+		infos[i] = index[name]
+	}
+	return infos, nil
+}
+
+// DeleteVersion 删除文档版本，包括各语言的文档、下载文件、构建结果及指向它的别名；
+// 删除别名时仅删除别名本身。latest 所指向的版本不能删除。
+func (b *Builder) DeleteVersion(name, v string) error {
+	opt, err := b.pm.GetName(strings.ToLower(name))
+	if err != nil {
+		return err
+	}
+	if err := lib.CheckVersionName(v); err != nil {
+		return err
+	}
+	if _, ok := opt.Aliases[v]; ok {
+		b.unlinkAlias(opt, v)
+		opt.RemoveAlias(v)
+		opt.SetHidden(v, false)
+		if err := opt.Writeback(b.pm); err != nil {
+			return err
+		}
+		// 手动设置的 stable 别名删除后恢复自动维护
+		isTag := b.tags(opt)
+		for _, dir := range b.langDirs(opt) {
+			if err := updateStable(opt, dir, isTag); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if v == opt.Latest {
+		return errors.New("cannot delete the latest version")
+	}
+	if !b.hasVersion(opt, v) {
+		return errors.New("not found version: " + v)
+	}
+	if err := b.removeVersion(&opt, v, b.tags(opt)); err != nil {
+		return err
+	}
+	return opt.Writeback(b.pm)
+}
+
+// HideVersion 在版本列表中隐藏或显示文档版本，隐藏的版本仍可直接访问
+func (b *Builder) HideVersion(name, v string, hidden bool) error {
+	opt, err := b.pm.GetName(strings.ToLower(name))
+	if err != nil {
+		return err
+	}
+	if _, ok := opt.Aliases[v]; !ok && !b.hasVersion(opt, v) {
+		return errors.New("not found version: " + v)
+	}
+	opt.SetHidden(v, hidden)
+	return opt.Writeback(b.pm)
+}
+
+// AliasVersion 为文档版本设置别名，在各语言中创建指向该版本的链接，别名已存在时改为指向新版本
+func (b *Builder) AliasVersion(name, alias, target string) error {
+	opt, err := b.pm.GetName(strings.ToLower(name))
+	if err != nil {
+		return err
+	}
+	if _, ok := opt.Aliases[alias]; !ok && b.hasVersion(opt, alias) {
+		return errors.New("alias conflicts with version: " + alias)
+	}
+	if !b.hasVersion(opt, target) {
+		return errors.New("not found version: " + target)
+	}
+	if err := opt.SetAlias(alias, target); err != nil {
+		return err
+	}
+	b.unlinkAlias(opt, alias)
+	if err := b.linkAliases(opt); err != nil {
+		return err
+	}
+	return opt.Writeback(b.pm)
+}
+
+// hasVersion 文档版本是否已发布或有构建结果，自动维护的 stable 链接不算
+func (b *Builder) hasVersion(opt lib.Options, v string) bool {
+	if _, err := b.pm.GetBuildset(opt.Name, v); err == nil {
+		return true
+	}
+	for _, dir := range b.langDirs(opt) {
+		if gtc.IsDir(filepath.Join(dir, v)) && !isAutoStable(opt, dir, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkAliases 在各语言中为已发布的目标版本创建别名链接
+func (b *Builder) linkAliases(opt lib.Options) error {
+	for _, dir := range b.langDirs(opt) {
+		for alias, target := range opt.Aliases {
+			if !gtc.IsDir(filepath.Join(dir, target)) {
+				continue
+			}
+			ln := filepath.Join(dir, alias)
+			if _, err := os.Lstat(ln); err == nil {
+				continue
+			}
+			if err := os.Symlink(filepath.Join(dir, target), ln); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unlinkAlias 删除各语言中的别名链接
+func (b *Builder) unlinkAlias(opt lib.Options, alias string) {
+	for _, dir := range b.langDirs(opt) {
+		if ln := filepath.Join(dir, alias); isSymlink(ln) {
+			os.Remove(ln)
+		}
+	}
+}
+
+// removeVersion 删除各语言中的某个文档版本及指向它的别名，opt 需由调用方写回。
+// 构建历史保留，其中的成功记录不会使重新构建被跳过（见 unchanged）。
+// isTag 为远程仓库的标签，用于更新 stable 链接。
+func (b *Builder) removeVersion(opt *lib.Options, v string, isTag map[string]bool) error {
+	if err := lib.CheckVersionName(v); err != nil {
+		return err
+	}
+	for _, alias := range opt.AliasesOf(v) {
+		b.unlinkAlias(*opt, alias)
+		opt.RemoveAlias(alias)
+		opt.SetHidden(alias, false)
+	}
+	opt.SetHidden(v, false)
+	for lang, langDir := range b.langDirs(*opt) {
+		// 已发布的版本是指向暂存目录的链接，RemoveAll 仅删除链接本身
+		link := filepath.Join(langDir, v)
+		if gtc.IsDir(link) || isSymlink(link) {
+			if err := os.RemoveAll(link); err != nil {
+				return err
+			}
+		}
+		os.RemoveAll(filepath.Join(langDir, stagingName, v))
+		os.RemoveAll(b.pm.DownloadsDir(opt.Name, lang, v))
+		if err := updateStable(*opt, langDir, isTag); err != nil {
+			return err
+		}
+	}
+	return b.pm.DelBuildset(opt.Name, v)
+}
+
+// isAutoStable 是否为自动维护的 stable 链接
+func isAutoStable(opt lib.Options, dir, v string) bool {
+	if _, ok := opt.Aliases[v]; ok || v != stableName {
+		return false
+	}
+	return isSymlink(filepath.Join(dir, v))
+}
+
+// stableTarget 自动维护的 stable 链接所指向的版本，不存在时返回空
+func stableTarget(opt lib.Options, dir string) string {
+	if !isAutoStable(opt, dir, stableName) {
+		return ""
+	}
+	target, err := os.Readlink(filepath.Join(dir, stableName))
+	if err != nil {
+		return ""
+	}
+	if rel, err := filepath.Rel(dir, target); err == nil {
+		return rel
+	}
+	return ""
+}
+
+// updateStable 更新语言目录下的 stable 链接，指向版本号最大的正式（非预发布）标签，
+// 没有正式版本时删除链接。stable 为手动设置的别名或同名分支时不处理。
+// isTag 为远程仓库的标签，与语义化版本同名的分支不会成为 stable。
+func updateStable(opt lib.Options, dir string, isTag map[string]bool) error {
+	if _, ok := opt.Aliases[stableName]; ok {
+		return nil
+	}
+	ln := filepath.Join(dir, stableName)
+	if _, err := os.Lstat(ln); err == nil && !isSymlink(ln) {
+		return nil
+	}
+	ds, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var tags []string
+	for _, d := range ds {
+		v := d.Name()
+		if isTag[v] && util.IsSemver(v) && gtc.IsDir(filepath.Join(dir, v)) {
+			tags = append(tags, v)
+		}
+	}
+	stable := util.StableVersion(tags)
+	if stable == "" {
+		if isSymlink(ln) {
+			return os.Remove(ln)
+		}
+		return nil
+	}
+	target := filepath.Join(dir, stable)
+	if cur, err := os.Readlink(ln); err == nil && cur == target {
+		return nil
+	}
+	return swapSymlink(target, ln, "auto")
+}
+
+func isSymlink(path string) bool {
+	fi, err := os.Lstat(path)
+	return err == nil && fi.Mode()&os.ModeSymlink != 0
+}
+
+// dirSize 目录（可以是链接）中所有文件的大小之和
+func dirSize(dir string) (size int64) {
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = real
+	}
+	filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,66 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+)
+
+func TestDirSize(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, ".builds", "v1", "id")
+	os.MkdirAll(filepath.Join(target, "_static"), 0755)
+	os.WriteFile(filepath.Join(target, "index.html"), make([]byte, 100), 0644)
+	os.WriteFile(filepath.Join(target, "_static", "a.js"), make([]byte, 28), 0644)
+	link := filepath.Join(dir, "v1")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	if n := dirSize(link); n != 128 {
+		t.Fatalf("got size %d, want 128", n)
+	}
+	if n := dirSize(filepath.Join(dir, "none")); n != 0 {
+		t.Fatalf("missing dir size should be 0, got %d", n)
+	}
+}
+
+func TestUpdateStable(t *testing.T) {
+	dir := t.TempDir()
+	opt := lib.Options{}
+	stable := func() string {
+		return stableTarget(opt, dir)
+	}
+	// 3.0 是维护分支，不能成为 stable
+	for _, v := range []string{"master", "3.0", "v1.2.0", "v1.10.0", "v2.0.0-rc.1"} {
+		os.MkdirAll(filepath.Join(dir, v), 0755)
+	}
+	isTag := map[string]bool{"v1.2.0": true, "v1.10.0": true, "v2.0.0-rc.1": true, "v2.0.0": true, "v3.0.0": true}
+	if err := updateStable(opt, dir, isTag); err != nil {
+		t.Fatal(err)
+	}
+	if s := stable(); s != "v1.10.0" {
+		t.Fatalf("stable should be v1.10.0, got %q", s)
+	}
+	os.MkdirAll(filepath.Join(dir, "v2.0.0"), 0755)
+	updateStable(opt, dir, isTag)
+	if s := stable(); s != "v2.0.0" {
+		t.Fatalf("stable should be v2.0.0, got %q", s)
+	}
+	for _, v := range []string{"v1.2.0", "v1.10.0", "v2.0.0"} {
+		os.RemoveAll(filepath.Join(dir, v))
+	}
+	updateStable(opt, dir, isTag)
+	if isSymlink(filepath.Join(dir, stableName)) {
+		t.Fatal("stable should be removed without release versions")
+	}
+
+	// 手动设置的别名优先
+	os.MkdirAll(filepath.Join(dir, "v3.0.0"), 0755)
+	opt.Aliases = map[string]string{stableName: "master"}
+	updateStable(opt, dir, isTag)
+	if isSymlink(filepath.Join(dir, stableName)) {
+		t.Fatal("stable alias should not be overwritten")
+	}
+}
@@ -0,0 +1,79 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Sphinx构建警告：通过 sphinx-build -w 写入文件，构建结束后统计
+
+package build
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// maxWarningText 构建结果中保存的警告内容上限
+const maxWarningText = 64 << 10
+
+// Sphinx输出的警告与错误行，如 index.rst:10: WARNING: ...
+var warningPat = regexp.MustCompile(`\b(WARNING|ERROR|SEVERE|CRITICAL):`)
+
+// parseWarnings 读取警告文件中的警告与错误行，文件不存在时返回空
+func parseWarnings(path string) (warnings []string) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if warningPat.MatchString(line) {
+			warnings = append(warnings, line)
+		}
+	}
+	return
+}
+
+// pathAlias 替换的路径前缀，name 为空时替换为相对路径
+type pathAlias struct {
+	path, name string
+}
+
+// cleanPaths 依次将行中的绝对路径前缀替换为其别名，应将更具体（更长）的路径排在前面
+func cleanPaths(line string, paths []pathAlias) string {
+	for _, p := range paths {
+		if p.path == "" || p.path == "/" {
+			continue
+		}
+		prefix := strings.TrimSuffix(p.path, "/") + "/"
+		if p.name == "" {
+			line = strings.ReplaceAll(line, prefix, "")
+		} else {
+			line = strings.ReplaceAll(line, prefix, p.name+"/")
+		}
+	}
+	return line
+}
+
+// warningText 合并警告内容，超出上限时截断
+func warningText(warnings []string) string {
+	text := strings.Join(warnings, "\n")
+	if len(text) > maxWarningText {
+		text = text[:strings.LastIndex(text[:maxWarningText], "\n")+1] + "..."
+	}
+	return text
+}
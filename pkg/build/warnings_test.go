@@ -0,0 +1,52 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseWarnings(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "warnings.log")
+	if len(parseWarnings(f)) != 0 {
+		t.Fatal("missing file should have no warnings")
+	}
+	os.WriteFile(f, []byte(`/src/docs/index.rst:10: WARNING: Title underline too short.
+
+Title
+====
+/src/docs/api.rst:3: ERROR: Unknown directive type "foo".
+WARNING: html_static_path entry '_static' does not exist
+`), 0644)
+	ws := parseWarnings(f)
+	if len(ws) != 3 || !strings.HasSuffix(ws[1], `Unknown directive type "foo".`) {
+		t.Fatalf("parse warnings error: %q", ws)
+	}
+
+	long := make([]string, 0)
+	for i := 0; i < 2000; i++ {
+		long = append(long, strings.Repeat("w", 99))
+	}
+	text := warningText(long)
+	if len(text) > maxWarningText+3 || !strings.HasSuffix(text, "\n...") {
+		t.Fatalf("warning text should be truncated, got %d bytes", len(text))
+	}
+	if warningText(ws[:1]) != ws[0] {
+		t.Fatal("short warning text should not change")
+	}
+}
+
+func TestCleanPaths(t *testing.T) {
+	paths := []pathAlias{
+		{"/data/rtfd/runtimes/abc/proj", ""}, {"/data/rtfd/cache/proj/venvs/k1", "$VIRTUAL_ENV"},
+		{"/data/rtfd/runtimes/abc", "$RUNTIME"}, {"/data/rtfd/", "$BASEDIR"}, {"", "$EMPTY"},
+	}
+	line := "/data/rtfd/runtimes/abc/proj/docs/index.rst:3: WARNING: x in " +
+		"/data/rtfd/cache/proj/venvs/k1/lib/ext.py, /data/rtfd/runtimes/abc/warnings-en.log, /data/rtfd/docs/proj"
+	want := "docs/index.rst:3: WARNING: x in " +
+		"$VIRTUAL_ENV/lib/ext.py, $RUNTIME/warnings-en.log, $BASEDIR/docs/proj"
+	if got := cleanPaths(line, paths); got != want {
+		t.Fatalf("clean paths error: %s", got)
+	}
+}
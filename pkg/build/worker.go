@@ -0,0 +1,174 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 构建worker：从Redis任务队列中取出构建任务运行，可运行在API服务内或其他主机上。
+// worker定时心跳，运行任务的worker失去心跳时，任务会被其他worker重新入队。
+
+package build
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"pkg/tcw.im/rtfd/pkg/lib"
+)
+
+const (
+	// 心跳间隔，同时检查取消请求、上传构建日志
+	heartbeatInterval = 5 * time.Second
+	// 队列为空时的轮询间隔
+	pollInterval = 2 * time.Second
+)
+
+// jobTask 队列任务转换为构建任务
+func jobTask(j lib.Job) *Task {
+	return &Task{ID: j.ID, Name: j.Name, Branch: j.Branch, Sender: j.Sender, Force: j.Force, queued: true}
+}
+
+// Enqueue 构建任务加入队列，如果同项目分支已有任务在排队，则返回排队中的任务
+func (b *Builder) Enqueue(t *Task) (*Task, error) {
+	j, err := b.pm.PushJob(lib.Job{
+		ID: t.ID, Name: t.Name, Branch: t.Branch, Sender: t.Sender, Force: t.Force,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobTask(j), nil
+}
+
+// Worker 构建worker
+type Worker struct {
+	b *Builder
+	// worker名，即 主机名:进程ID:序号，全局唯一
+	Name string
+
+	mu sync.Mutex
+	// 正在运行的任务
+	job *lib.Job
+}
+
+// NewWorker 新建构建worker，index 是同一进程内的序号
+func NewWorker(b *Builder, index int) *Worker {
+	host, _ := os.Hostname()
+	return &Worker{b: b, Name: fmt.Sprintf("%s:%d:%d", host, os.Getpid(), index)}
+}
+
+// timeout 超过此时间没有心跳的worker视为已失效
+func (w *Worker) timeout() time.Duration {
+	n := w.b.pm.CFG().MustInt("build", "worker_timeout", 30)
+	if n < 1 {
+		n = 30
+	}
+	return time.Duration(n) * time.Second
+}
+
+// Run 循环取出并运行构建任务，stop 关闭后运行完当前任务即退出
+func (w *Worker) Run(stop <-chan struct{}) {
+	done := make(chan struct{})
+	defer close(done)
+	defer w.b.pm.RemoveWorker(w.Name)
+	w.beat()
+	go func() {
+		tick := time.NewTicker(heartbeatInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				w.beat()
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		j, err := w.b.pm.PopJob(w.Name)
+		if err != nil {
+			log.Printf("worker %s: pop job failed: %s\n", w.Name, err)
+		}
+		if j == nil {
+			select {
+			case <-stop:
+				return
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+		w.run(j)
+	}
+}
+
+// run 运行任务，结束后上传构建日志并注销任务
+func (w *Worker) run(j *lib.Job) {
+	w.mu.Lock()
+	w.job = j
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		w.job = nil
+		w.mu.Unlock()
+	}()
+
+	if err := w.b.BuildTask(jobTask(*j)); err != nil {
+		log.Printf("build %s(%s) failed: %s\n", j.Name, j.ID, err)
+	}
+	w.uploadLog(j)
+	w.b.pm.FinishJob(*j)
+}
+
+// beat 心跳，并处理运行中任务的取消请求、上传其构建日志，以及重新入队失效worker的任务
+func (w *Worker) beat() {
+	if err := w.b.pm.Heartbeat(w.Name); err != nil {
+		log.Printf("worker %s: heartbeat failed: %s\n", w.Name, err)
+	}
+
+	w.mu.Lock()
+	j := w.job
+	w.mu.Unlock()
+	if j != nil {
+		if w.b.pm.CancelRequested(j.ID) {
+			if err := w.b.Cancel(j.ID); err != nil {
+				log.Printf("cancel %s(%s) failed: %s\n", j.Name, j.ID, err)
+			}
+		}
+		w.uploadLog(j)
+	}
+
+	jobs, err := w.b.pm.RequeueStale(w.timeout(), genID)
+	if err != nil {
+		log.Printf("worker %s: requeue failed: %s\n", w.Name, err)
+	}
+	for _, j := range jobs {
+		log.Printf("worker %s: requeued %s %s as %s\n", w.Name, j.Name, j.Branch, j.ID)
+	}
+}
+
+// uploadLog 上传构建日志，供其他主机上的API服务读取
+func (w *Worker) uploadLog(j *lib.Job) {
+	data, err := os.ReadFile(w.b.pm.LogPath(j.Name, j.ID))
+	if err != nil {
+		return
+	}
+	w.b.pm.SaveLog(j.ID, data)
+}
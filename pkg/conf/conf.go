@@ -19,6 +19,7 @@
 package conf
 
 import (
+	"strconv"
 	"strings"
 
 	"pkg/tcw.im/rtfd/vars"
@@ -80,6 +81,15 @@ func (c Config) MustKey(section, key, defaults string) string {
 	return v
 }
 
+// MustInt 获取分区下某个键的整数值，值为空或非法时返回默认值
+func (c Config) MustInt(section, key string, defaults int) int {
+	v, err := strconv.Atoi(c.GetKey(section, key))
+	if err != nil {
+		return defaults
+	}
+	return v
+}
+
 // AllHash 获取ini文件所有分区的经过解析的键值对
 func (c Config) AllHash() (data map[string]map[string]string) {
 	data = make(map[string]map[string]string)
@@ -126,3 +136,19 @@ func (c Config) BaseDir() string {
 func (c Config) DefaultBranch() string {
 	return c.MustKey(vars.DFT, "default_branch", "master")
 }
+
+// Interpreters 获取py分区声明的Python解释器（专项方法），键为版本名称，值为命令路径，
+// 其中 py2、py3 的版本名称为 2、3
+func (c Config) Interpreters() map[string]string {
+	data := make(map[string]string)
+	for k, v := range c.SecHash("py") {
+		if k == "index" || v == "" {
+			continue
+		}
+		if k == "py2" || k == "py3" {
+			k = strings.TrimPrefix(k, "py")
+		}
+		data[k] = v
+	}
+	return data
+}
@@ -14,6 +14,9 @@ func TestConf(t *testing.T) {
     gn = global
     [project]
     latest = master
+    [build]
+    workers = 4
+    timeout = x
     `)
 	f := filepath.Join(os.TempDir(), "_rtfd_conf_test.ini")
 	err := os.WriteFile(f, data, 0644)
@@ -40,6 +43,7 @@ func TestConf(t *testing.T) {
 	project := make(map[string]string)
 	project["latest"] = "master"
 	hash["project"] = project
+	hash["build"] = map[string]string{"workers": "4", "timeout": "x"}
 	if reflect.DeepEqual(hash, cfg.AllHash()) != true {
 		t.Fatal("all hash error")
 	}
@@ -52,4 +56,35 @@ func TestConf(t *testing.T) {
 		t.Fatal("must get key error")
 	}
 
+	if cfg.MustInt("build", "workers", 1) != 4 {
+		t.Fatal("must int error")
+	}
+	if cfg.MustInt("build", "timeout", 60) != 60 {
+		t.Fatal("must int with invalid value error")
+	}
+	if cfg.MustInt("build", "non", 2) != 2 {
+		t.Fatal("must int with default error")
+	}
+
+}
+
+func TestInterpreters(t *testing.T) {
+	data := []byte(`
+    [py]
+    py2 = python2
+    py3 = python3
+    3.8 = /usr/bin/python3.8
+    3.12 =
+    index = https://pypi.org/simple
+    `)
+	f := filepath.Join(t.TempDir(), "rtfd.cfg")
+	os.WriteFile(f, data, 0644)
+	cfg, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"2": "python2", "3": "python3", "3.8": "/usr/bin/python3.8"}
+	if !reflect.DeepEqual(want, cfg.Interpreters()) {
+		t.Fatalf("interpreters error: %v", cfg.Interpreters())
+	}
 }
@@ -0,0 +1,140 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 构建环境变量：加密保存于 BEK，仅在构建时导出到构建进程的环境中
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"pkg/tcw.im/rtfd/pkg/util"
+)
+
+// BEK 生成文档项目构建环境变量Key，hash类型，键为变量名，值为加密后的变量值
+func BEK(projectName string) string {
+	projectName = strings.ToLower(projectName)
+	return "env:" + projectName
+}
+
+// 构建流程自身使用的环境变量，不允许项目设置
+var reservedEnv = []string{"PATH", "VIRTUAL_ENV", "HOME", "GIT_TERMINAL_PROMPT"}
+
+// CheckEnvName 校验环境变量名
+func CheckEnvName(key string) error {
+	if !util.IsEnvName(key) {
+		return fmt.Errorf("invalid env name: %s", key)
+	}
+	upper := strings.ToUpper(key)
+	for _, r := range reservedEnv {
+		if upper == r {
+			return fmt.Errorf("reserved env name: %s", key)
+		}
+	}
+	if strings.HasPrefix(upper, "RTFD_") {
+		return fmt.Errorf("reserved env name: %s", key)
+	}
+	return nil
+}
+
+// envSecret 加密环境变量的密钥，即系统配置 build 分区的 env_key
+func (pm *ProjectManager) envSecret() (string, error) {
+	secret := pm.cfg.GetKey("build", "env_key")
+	if secret == "" {
+		return "", errors.New("env_key is not configured in the build section")
+	}
+	return secret, nil
+}
+
+// CheckEnv 校验将要设置的构建环境变量：变量名可用，且已配置加密密钥
+func (pm *ProjectManager) CheckEnv(env map[string]string) error {
+	if len(env) == 0 {
+		return nil
+	}
+	for k := range env {
+		if err := CheckEnvName(k); err != nil {
+			return err
+		}
+	}
+	_, err := pm.envSecret()
+	return err
+}
+
+// SetEnv 设置构建环境变量
+func (pm *ProjectManager) SetEnv(name, key, value string) error {
+	if !pm.HasName(name) {
+		return errors.New("not found project")
+	}
+	if err := CheckEnvName(key); err != nil {
+		return err
+	}
+	secret, err := pm.envSecret()
+	if err != nil {
+		return err
+	}
+	ct, err := util.Encrypt(secret, value)
+	if err != nil {
+		return err
+	}
+	_, err = pm.db.HSet(BEK(name), key, ct)
+	return err
+}
+
+// UnsetEnv 删除构建环境变量
+func (pm *ProjectManager) UnsetEnv(name string, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := pm.db.HDel(BEK(name), keys...)
+	return err
+}
+
+// GetEnv 获取解密后的构建环境变量
+func (pm *ProjectManager) GetEnv(name string) (map[string]string, error) {
+	vals, err := pm.db.HGetAll(BEK(name))
+	if err != nil {
+		return nil, err
+	}
+	env := make(map[string]string, len(vals))
+	if len(vals) == 0 {
+		return env, nil
+	}
+	secret, err := pm.envSecret()
+	if err != nil {
+		return nil, err
+	}
+	for k, ct := range vals {
+		v, err := util.Decrypt(secret, ct)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt env %s failed: %w", k, err)
+		}
+		env[k] = v
+	}
+	return env, nil
+}
+
+// EnvList 将环境变量转换为 KEY=VALUE 形式（按名称排序）
+func EnvList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for k, v := range env {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return list
+}
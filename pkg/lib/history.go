@@ -0,0 +1,266 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 构建历史：每次构建单独记录，可按构建ID查询或分页列出
+
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// BuildHistory 分页的构建历史
+type BuildHistory struct {
+	// 构建历史总条数
+	Total int
+	// 当前页码，从1开始
+	Page int
+	// 每页条数
+	Limit int
+	// 构建结果（按时间倒序）
+	Builds []Result
+}
+
+// Running 正在运行的构建
+type Running struct {
+	// 构建ID
+	ID string
+	// 文档项目名
+	Name string
+	// 分支或标签
+	Branch string
+	// 构建进程ID，亦是进程组ID
+	Pid int
+	// 构建运行时的临时目录
+	Runtime Path
+	// 运行构建的主机名
+	Host string
+	// 构建开始时间
+	Stime string
+}
+
+// keepBuilds 项目保留的构建历史条数，项目未设置时使用系统配置
+func (pm *ProjectManager) keepBuilds(name string) int {
+	keep := pm.cfg.MustInt("build", "keep_builds", 50)
+	if opt, err := pm.GetName(name); err == nil && opt.KeepBuilds > 0 {
+		keep = opt.KeepBuilds
+	}
+	if keep < 1 {
+		keep = 1
+	}
+	return keep
+}
+
+// historyRecord 写入或更新一条构建历史，新记录会追加到列表头部并清理超出保留条数的记录
+func (pm *ProjectManager) historyRecord(name, id, rst string) error {
+	_, err := pm.db.HGet(BHK(name), id)
+	isNew := err == redis.ErrNil
+	if err != nil && !isNew {
+		return err
+	}
+	_, err = pm.db.HSet(BHK(name), id, rst)
+	if err != nil {
+		return err
+	}
+	if !isNew {
+		return nil
+	}
+	_, err = pm.db.LPush(BLK(name), id)
+	if err != nil {
+		return err
+	}
+	return pm.trimHistory(name)
+}
+
+// trimHistory 删除超出保留条数的构建历史及其日志文件
+func (pm *ProjectManager) trimHistory(name string) error {
+	keep := pm.keepBuilds(name)
+	expired, err := pm.db.LRange(BLK(name), keep, -1)
+	if err != nil {
+		return err
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	for _, id := range expired {
+		if rst, e := pm.GetBuildByID(name, id); e == nil && rst.Log != "" {
+			os.Remove(rst.Log)
+		}
+		_, err = pm.db.HDel(BHK(name), id)
+		if err != nil {
+			return err
+		}
+		pm.db.HDel(GLK, id)
+	}
+	_, err = pm.db.LTrim(BLK(name), 0, keep-1)
+	return err
+}
+
+// BuildStart 构建开始时写入构建历史（不影响分支最新结果）
+func (pm *ProjectManager) BuildStart(name string, result Result) error {
+	rst, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return pm.historyRecord(strings.ToLower(name), result.ID, string(rst))
+}
+
+// HistoryUpdate 仅更新构建历史中的某条记录
+func (pm *ProjectManager) HistoryUpdate(name string, result Result) error {
+	rst, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = pm.db.HSet(BHK(name), result.ID, string(rst))
+	return err
+}
+
+// finishScript 仅当构建历史中的记录仍在运行时，原子地写入构建结果到构建历史与分支最新结果
+// KEYS: BHK BRK，ARGV: 构建ID、分支或标签、构建结果、运行中状态
+const finishScript = `
+local cur = redis.call('HGET', KEYS[1], ARGV[1])
+if not cur or cjson.decode(cur).State ~= ARGV[4] then return 0 end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+redis.call('HSET', KEYS[2], ARGV[2], ARGV[3])
+return 1
+`
+
+// FinishBuild 结束运行中的构建，记录构建结果（含分支最新结果）。
+// 构建已结束（完成、被取消或被判定失联）时不做修改，返回 false，避免结束与取消互相覆盖。
+func (pm *ProjectManager) FinishBuild(name, branchOrTag string, result Result) (bool, error) {
+	name = strings.ToLower(name)
+	rst, err := json.Marshal(result)
+	if err != nil {
+		return false, err
+	}
+	n, err := redis.Int(pm.eval(
+		finishScript, []string{BHK(name), BRK(name)},
+		result.ID, branchOrTag, string(rst), string(StateRunning),
+	))
+	return n > 0, err
+}
+
+// SetRunning 登记正在运行的构建
+func (pm *ProjectManager) SetRunning(r Running) error {
+	val, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = pm.db.HSet(GBRK, r.ID, string(val))
+	return err
+}
+
+// GetRunning 获取正在运行的构建
+func (pm *ProjectManager) GetRunning(id string) (r Running, err error) {
+	val, err := pm.db.HGet(GBRK, id)
+	if err != nil {
+		if err == redis.ErrNil {
+			err = errors.New("not found running build")
+		}
+		return
+	}
+	err = json.Unmarshal([]byte(val), &r)
+	return
+}
+
+// DelRunning 构建结束后注销
+func (pm *ProjectManager) DelRunning(id string) error {
+	_, err := pm.db.HDel(GBRK, id)
+	return err
+}
+
+// GetBuildByID 根据构建ID获取构建结果
+func (pm *ProjectManager) GetBuildByID(name, id string) (builder Result, err error) {
+	val, err := pm.db.HGet(BHK(name), id)
+	if err != nil {
+		if err == redis.ErrNil {
+			err = errors.New("not found build")
+		}
+		return
+	}
+	err = json.Unmarshal([]byte(val), &builder)
+	return
+}
+
+// GetBuildByCommit 根据git提交（前缀至少4位）获取最近一次已结束的构建结果
+func (pm *ProjectManager) GetBuildByCommit(name, commit string) (builder Result, err error) {
+	commit = strings.ToLower(commit)
+	if len(commit) < 4 {
+		err = errors.New("commit too short")
+		return
+	}
+	ids, err := pm.db.LRange(BLK(name), 0, -1)
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		rst, e := pm.GetBuildByID(name, id)
+		if e != nil || rst.State == StateRunning || rst.State == StateSkipped {
+			continue
+		}
+		if strings.HasPrefix(rst.Commit, commit) {
+			return rst, nil
+		}
+	}
+	err = errors.New("not found build")
+	return
+}
+
+// LastPassing 获取分支当前的构建结果，仅在其为构建成功时返回。
+// 不回溯构建历史：版本被删除后其历史记录仍在，但已不代表发布中的文档。
+func (pm *ProjectManager) LastPassing(name, branch string) (builder Result, err error) {
+	rst, err := pm.GetBuildset(name, branch)
+	if err != nil {
+		return
+	}
+	if !rst.Status {
+		err = errors.New("not found passing build")
+		return
+	}
+	return rst, nil
+}
+
+// ListHistory 分页获取构建历史，page从1开始
+func (pm *ProjectManager) ListHistory(name string, page, limit int) (h BuildHistory, err error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+	total, err := pm.db.LLen(BLK(name))
+	if err != nil {
+		return
+	}
+	ids, err := pm.db.LRange(BLK(name), (page-1)*limit, page*limit-1)
+	if err != nil {
+		return
+	}
+	builds := make([]Result, 0, len(ids))
+	for _, id := range ids {
+		rst, e := pm.GetBuildByID(name, id)
+		if e != nil {
+			continue
+		}
+		builds = append(builds, rst)
+	}
+	return BuildHistory{Total: total, Page: page, Limit: limit, Builds: builds}, nil
+}
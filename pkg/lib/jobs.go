@@ -0,0 +1,353 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 构建任务队列：API等生产者将任务写入Redis，由（可能位于其他主机的）worker取出运行。
+//
+// 数据 Key 命名：
+// 1. 排队中的任务写入 GJPK，类型为hash，键为 项目名:分支，同项目分支的排队任务合并为一个；
+//    其键同时按入队顺序写入 GJQK，类型为list
+// 2. 已被取出运行的任务写入 GJRK，类型为hash，键为构建ID；
+//    同时写入 GJKK，类型为hash，键为 项目名:分支，值为构建ID，用于保证同项目分支同时只运行一个任务
+// 3. worker心跳写入 GWK，类型为hash，键为worker名，值为最近一次心跳的unix时间戳
+// 4. 请求取消的构建写入 GCK，类型为hash，键为构建ID
+// 5. worker上传的构建日志写入 GLK，类型为hash，键为构建ID
+
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/tcw.im/rtfd/vars"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var (
+	// GJQK 排队中的任务键，list类型
+	GJQK = "jobs:queue"
+	// GJPK 排队中的任务，hash类型
+	GJPK = "jobs:pending"
+	// GJRK 运行中的任务，hash类型
+	GJRK = "jobs:running"
+	// GJKK 运行中任务的项目分支，hash类型
+	GJKK = "jobs:running:keys"
+	// GWK worker心跳，hash类型
+	GWK = "workers"
+	// GCK 请求取消的构建，hash类型
+	GCK = "cancel"
+	// GLK 构建日志，hash类型
+	GLK = "logs"
+	// GSLK 定时构建检查锁的键前缀，string类型，后接检查时间（UTC，精确到分钟）
+	GSLK = "schedule:lock:"
+)
+
+// MaxLogSize 上传到Redis的构建日志大小上限，超出时仅保留末尾部分
+const MaxLogSize = 1 << 20
+
+// MaxJobRetries 任务因 worker 失去心跳而重新入队的最大次数，超过后不再重试
+const MaxJobRetries = 3
+
+// pushScript 原子地将任务入队：同项目分支已有任务在排队时不再入队，仅合并强制构建标记，
+// 返回排队中的任务
+// KEYS: GJQK GJPK，ARGV: 任务去重标识、任务、是否强制构建（1/0）
+const pushScript = `
+local val = redis.call('HGET', KEYS[2], ARGV[1])
+if val then
+	local job = cjson.decode(val)
+	if ARGV[3] == '1' and not job['Force'] then
+		job['Force'] = true
+		val = cjson.encode(job)
+		redis.call('HSET', KEYS[2], ARGV[1], val)
+	end
+	return val
+end
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+redis.call('LPUSH', KEYS[1], ARGV[1])
+return ARGV[2]
+`
+
+// popScript 原子地取出最早入队的可运行任务并登记为运行中：同项目分支已有任务在运行时放回队尾，
+// 继续检查下一个，直到找到可运行的任务或每个任务都检查过一次。
+// 返回写入 GJRK 的任务（已填充worker名），没有可运行的任务时返回 nil
+// KEYS: GJQK GJPK GJRK GJKK，ARGV: worker名
+const popScript = `
+local n = redis.call('LLEN', KEYS[1])
+for i = 1, n do
+	local key = redis.call('RPOP', KEYS[1])
+	if not key then return false end
+	local val = redis.call('HGET', KEYS[2], key)
+	if val then
+		if redis.call('HEXISTS', KEYS[4], key) == 1 then
+			redis.call('LPUSH', KEYS[1], key)
+		else
+			local job = cjson.decode(val)
+			job['Worker'] = ARGV[1]
+			val = cjson.encode(job)
+			redis.call('HDEL', KEYS[2], key)
+			redis.call('HSET', KEYS[3], job['ID'], val)
+			redis.call('HSET', KEYS[4], key, job['ID'])
+			return val
+		end
+	end
+end
+return false
+`
+
+// releaseScript 原子地注销运行中的任务，返回是否由本次注销（多个 worker 同时处理时仅一个成功）
+// KEYS: GJRK GJKK，ARGV: 构建ID、任务去重标识
+const releaseScript = `
+local n = redis.call('HDEL', KEYS[1], ARGV[1])
+if redis.call('HGET', KEYS[2], ARGV[2]) == ARGV[1] then
+	redis.call('HDEL', KEYS[2], ARGV[2])
+end
+return n
+`
+
+// Job 队列中的构建任务
+type Job struct {
+	// 构建ID
+	ID string
+	// 文档项目名
+	Name string
+	// 分支或标签
+	Branch string
+	// 发起构建的来源
+	Sender vars.Sender
+	// 强制构建，即使提交与最近一次成功构建相同
+	Force bool
+	// 入队时间（unix时间戳）
+	Queued int64
+	// 取出任务的worker名（运行时填充）
+	Worker string
+	// 被重新入队的次数
+	Retries int
+}
+
+// Key 任务去重标识，即项目名与分支
+func (j Job) Key() string {
+	return strings.ToLower(j.Name) + ":" + j.Branch
+}
+
+// eval 执行Lua脚本，键会加上数据库前缀
+func (pm *ProjectManager) eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	params := []interface{}{script, len(keys)}
+	for _, k := range keys {
+		params = append(params, pm.db.Prefix+k)
+	}
+	return pm.db.Do("EVAL", append(params, args...)...)
+}
+
+// PushJob 任务入队，如果同项目分支已有任务在排队，则返回排队中的任务（合并强制构建标记）。
+// 去重检查与入队在一个Lua脚本中完成，并发入队同一项目分支时只会排队一个任务。
+func (pm *ProjectManager) PushJob(j Job) (Job, error) {
+	if j.Queued == 0 {
+		j.Queued = time.Now().Unix()
+	}
+	val, err := json.Marshal(j)
+	if err != nil {
+		return j, err
+	}
+	force := "0"
+	if j.Force {
+		force = "1"
+	}
+	rst, err := redis.String(pm.eval(pushScript, []string{GJQK, GJPK}, j.Key(), string(val), force))
+	if err != nil {
+		return j, err
+	}
+	var queued Job
+	if err = json.Unmarshal([]byte(rst), &queued); err != nil {
+		return j, err
+	}
+	return queued, nil
+}
+
+// PopJob 取出最早入队的任务并登记为由 worker 运行，队列为空时返回 nil；
+// 同项目分支已有任务在运行时，将其放回队尾。取出与登记在一个Lua脚本中完成，多个 worker 不会重复运行。
+func (pm *ProjectManager) PopJob(worker string) (*Job, error) {
+	val, err := redis.String(pm.eval(popScript, []string{GJQK, GJPK, GJRK, GJKK}, worker))
+	if err != nil {
+		if err == redis.ErrNil {
+			err = nil
+		}
+		return nil, err
+	}
+	var j Job
+	if err := json.Unmarshal([]byte(val), &j); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// releaseJob 注销运行中的任务，返回是否由本次注销
+func (pm *ProjectManager) releaseJob(j Job) (bool, error) {
+	n, err := redis.Int(pm.eval(releaseScript, []string{GJRK, GJKK}, j.ID, j.Key()))
+	return n > 0, err
+}
+
+// FinishJob 任务运行结束后注销
+func (pm *ProjectManager) FinishJob(j Job) error {
+	_, err := pm.releaseJob(j)
+	pm.db.HDel(GCK, j.ID)
+	return err
+}
+
+// RunningJobs 获取运行中的任务
+func (pm *ProjectManager) RunningJobs() (jobs []Job, err error) {
+	vals, err := pm.db.HGetAll(GJRK)
+	if err != nil {
+		return
+	}
+	for _, val := range vals {
+		var j Job
+		if e := json.Unmarshal([]byte(val), &j); e == nil {
+			jobs = append(jobs, j)
+		}
+	}
+	return
+}
+
+// PendingJobs 排队中的任务数
+func (pm *ProjectManager) PendingJobs() (int, error) {
+	return pm.db.LLen(GJQK)
+}
+
+// Heartbeat 记录 worker 心跳
+func (pm *ProjectManager) Heartbeat(worker string) error {
+	_, err := pm.db.HSet(GWK, worker, strconv.FormatInt(time.Now().Unix(), 10))
+	return err
+}
+
+// Workers 获取全部 worker 最近一次心跳时间
+func (pm *ProjectManager) Workers() (map[string]time.Time, error) {
+	vals, err := pm.db.HGetAll(GWK)
+	if err != nil {
+		return nil, err
+	}
+	beats := make(map[string]time.Time)
+	for w, v := range vals {
+		ts, e := strconv.ParseInt(v, 10, 64)
+		if e == nil {
+			beats[w] = time.Unix(ts, 0)
+		}
+	}
+	return beats, nil
+}
+
+// RemoveWorker worker 正常退出时注销
+func (pm *ProjectManager) RemoveWorker(worker string) error {
+	_, err := pm.db.HDel(GWK, worker)
+	return err
+}
+
+// isStale 运行任务的 worker 超过 timeout 没有心跳（或已注销）
+func isStale(j Job, beats map[string]time.Time, now time.Time, timeout time.Duration) bool {
+	beat, ok := beats[j.Worker]
+	return !ok || now.Sub(beat) > timeout
+}
+
+// RequeueStale 将 worker 失去心跳的运行中任务重新入队，原构建记录为失败，返回重新入队的任务
+func (pm *ProjectManager) RequeueStale(timeout time.Duration, newID func() string) (jobs []Job, err error) {
+	running, err := pm.RunningJobs()
+	if err != nil {
+		return
+	}
+	beats, err := pm.Workers()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, j := range running {
+		if !isStale(j, beats, now, timeout) {
+			continue
+		}
+		// 注销成功者负责重新入队，避免多个 worker 重复处理
+		if ok, e := pm.releaseJob(j); e != nil || !ok {
+			continue
+		}
+		giveUp := j.Retries >= MaxJobRetries
+		if rst, e := pm.GetBuildByID(j.Name, j.ID); e == nil && rst.State == StateRunning {
+			rst.State = StateFailing
+			rst.Step = "worker lost"
+			if giveUp {
+				rst.Step = fmt.Sprintf("worker lost (gave up after %d retries)", j.Retries)
+			}
+			rst.Btime = now.Format("2006-01-02 15:04:05")
+			pm.HistoryUpdate(j.Name, rst)
+			if giveUp {
+				pm.BuildRecord(j.Name, j.Branch, rst)
+			}
+		}
+		pm.DelRunning(j.ID)
+		// 反复使 worker 失联的任务不再重试
+		if giveUp {
+			continue
+		}
+		j.ID = newID()
+		j.Worker = ""
+		j.Retries++
+		if j, err = pm.PushJob(j); err != nil {
+			return
+		}
+		jobs = append(jobs, j)
+	}
+	return
+}
+
+// RequestCancel 请求取消在其他主机上运行的构建，由运行该构建的 worker 执行
+func (pm *ProjectManager) RequestCancel(id string) error {
+	_, err := pm.db.HSet(GCK, id, strconv.FormatInt(time.Now().Unix(), 10))
+	return err
+}
+
+// CancelRequested 构建是否已被请求取消
+func (pm *ProjectManager) CancelRequested(id string) bool {
+	_, err := pm.db.HGet(GCK, id)
+	return err == nil
+}
+
+// ScheduleLock 获取时间 t 所在分钟的定时构建检查锁，多个API服务同时检查时仅一个获取成功
+func (pm *ProjectManager) ScheduleLock(t time.Time, owner string) (bool, error) {
+	key := pm.db.Prefix + GSLK + t.UTC().Format("200601021504")
+	_, err := redis.String(pm.db.Do("SET", key, owner, "NX", "EX", 120))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SaveLog 上传构建日志，超出 MaxLogSize 时仅保留末尾部分
+func (pm *ProjectManager) SaveLog(id string, log []byte) error {
+	if len(log) > MaxLogSize {
+		log = log[len(log)-MaxLogSize:]
+	}
+	_, err := pm.db.HSet(GLK, id, string(log))
+	return err
+}
+
+// GetLog 获取已上传的构建日志
+func (pm *ProjectManager) GetLog(id string) (log string, err error) {
+	log, err = pm.db.HGet(GLK, id)
+	if err == redis.ErrNil {
+		err = errors.New("not found build log")
+	}
+	return
+}
@@ -38,10 +38,16 @@ import (
 )
 
 type (
-	// PyVer Python版本
-	PyVer uint8
+	// PyVer Python版本，即系统配置py分区中声明的解释器名称
+	PyVer string
 	// BuilderType 构建器类型
 	BuilderType string
+	// Engine 文档引擎
+	Engine string
+	// InjectMode rtfd.js 与 favicon 的注入方式
+	InjectMode string
+	// BuildState 构建状态
+	BuildState string
 	// Path 文件或目录路径
 	Path = string
 	// URL 包含协议头的地址
@@ -50,9 +56,9 @@ type (
 
 const (
 	// PY2 is Python 2.x
-	PY2 PyVer = 2
+	PY2 PyVer = "2"
 	// PY3 is Python 3.x
-	PY3 PyVer = 3
+	PY3 PyVer = "3"
 
 	// HTMLBuilder HTML构建器
 	HTMLBuilder BuilderType = "html"
@@ -60,8 +66,131 @@ const (
 	DirHTMLBuilder BuilderType = "dirhtml"
 	// SingleHTMLBuilder 单页HTML构建器
 	SingleHTMLBuilder BuilderType = "singlehtml"
+	// CustomBuilder 自定义命令构建器，适用于任意静态站点生成器
+	CustomBuilder BuilderType = "custom"
+
+	// SphinxEngine 使用 sphinx-build 构建（默认）
+	SphinxEngine Engine = "sphinx"
+	// MkDocsEngine 使用 mkdocs build 构建
+	MkDocsEngine Engine = "mkdocs"
+
+	// InjectHTML 构建完成后向生成的HTML文件插入（默认）
+	InjectHTML InjectMode = "html"
+	// InjectConf 构建前写入文档配置（Sphinx的conf.py、MkDocs的extra_javascript）
+	InjectConf InjectMode = "conf"
+	// InjectNone 不注入
+	InjectNone InjectMode = "none"
+
+	// FormatPDF PDF文档（latex构建器与latexmk）
+	FormatPDF = "pdf"
+	// FormatEPUB EPUB电子书
+	FormatEPUB = "epub"
+	// FormatHTMLZip 打包的HTML文档
+	FormatHTMLZip = "htmlzip"
+
+	// StateRunning 构建中
+	StateRunning BuildState = "running"
+	// StatePassing 构建成功
+	StatePassing BuildState = "passing"
+	// StateFailing 构建失败
+	StateFailing BuildState = "failing"
+	// StateCancelled 构建被取消
+	StateCancelled BuildState = "cancelled"
+	// StateTimeout 构建超时被终止
+	StateTimeout BuildState = "timeout"
+	// StateSkipped 提交未变化，跳过构建
+	StateSkipped BuildState = "skipped"
+	// StatePartial 部分语言已发布，其余语言发布失败
+	StatePartial BuildState = "partial"
 )
 
+// UnmarshalJSON 兼容旧版本以数字存储的Python版本
+func (v *PyVer) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = PyVer(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*v = PyVer(n.String())
+	return nil
+}
+
+// IsValid 是否为支持的构建器
+func (b BuilderType) IsValid() bool {
+	switch b {
+	case HTMLBuilder, DirHTMLBuilder, SingleHTMLBuilder, CustomBuilder:
+		return true
+	}
+	return false
+}
+
+// IsValid 是否为支持的注入方式，为空时即默认的html
+func (m InjectMode) IsValid() bool {
+	switch m {
+	case "", InjectHTML, InjectConf, InjectNone:
+		return true
+	}
+	return false
+}
+
+// FormatList 额外构建的下载格式列表
+func (opt Options) FormatList() (formats []string) {
+	// 命令行更新规则以逗号分隔字段，故亦可用 | 分隔
+	split := func(r rune) bool { return r == ',' || r == '|' }
+	for _, f := range strings.FieldsFunc(opt.Formats, split) {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f != "" {
+			formats = append(formats, f)
+		}
+	}
+	return
+}
+
+// CheckFormats 校验下载格式
+func CheckFormats(formats string) error {
+	for _, f := range (Options{Formats: formats}).FormatList() {
+		if f != FormatPDF && f != FormatEPUB && f != FormatHTMLZip {
+			return fmt.Errorf("invalid format: %s", f)
+		}
+	}
+	return nil
+}
+
+// DownloadsDir 下载文件目录，即 docs/<name>/_downloads/<lang>/<branch>
+func (pm *ProjectManager) DownloadsDir(name, lang, branch string) Path {
+	name = strings.ToLower(name)
+	return filepath.Join(pm.cfg.BaseDir(), "docs", name, "_downloads", lang, branch)
+}
+
+// IsCustom 是否使用自定义命令构建
+func (opt Options) IsCustom() bool {
+	return opt.Builder == CustomBuilder
+}
+
+// CheckCustom 自定义构建器必须设置构建命令与输出目录，输出目录清理后须位于项目之内且不能是项目本身
+// （构建前会删除输出目录）
+func (opt Options) CheckCustom() error {
+	if !opt.IsCustom() {
+		return nil
+	}
+	if strings.TrimSpace(opt.Command) == "" || opt.OutputDir == "" {
+		return errors.New("command and outputdir are required for custom builder")
+	}
+	if od, ok := util.SubPath(opt.OutputDir); !ok || od == "." {
+		return errors.New("illegal outputdir")
+	}
+	return nil
+}
+
+// IsMkDocs 是否使用 MkDocs 构建
+func (opt Options) IsMkDocs() bool {
+	return opt.Engine == MkDocsEngine
+}
+
 // Options 每个文档项目的配置项
 type Options struct {
 	// 项目在数据库中唯一标识名
@@ -70,7 +199,7 @@ type Options struct {
 	URL URL
 	// 默认显示的分支
 	Latest string
-	// 使用的python版本，2或3
+	// 使用的python版本，即系统配置py分区中声明的名称
 	Version PyVer
 	// 是否单一版本
 	Single bool
@@ -100,8 +229,20 @@ type Options struct {
 	SSLPublic Path
 	// 自定义域名的ssl私钥
 	SSLPrivate Path
-	// Sphinx构建器，支持html、dirhtml、singlehtml
+	// 文档引擎，支持sphinx、mkdocs，为空时即sphinx
+	Engine Engine
+	// Sphinx构建器，支持html、dirhtml、singlehtml；custom表示使用自定义命令构建
 	Builder BuilderType
+	// 自定义构建器的构建命令，在源码目录中执行
+	Command string
+	// 自定义构建器的输出目录，是项目的相对位置
+	OutputDir Path
+	// rtfd.js 与 favicon 的注入方式，支持html、conf、none，为空时即html
+	Inject InjectMode
+	// 额外构建的下载格式（仅Sphinx），支持pdf、epub、htmlzip，以半角逗号或|分隔
+	Formats string
+	// Sphinx构建有警告时视为构建失败
+	FailOnWarning bool
 	// git服务提供商（自动填充）
 	GSP string
 	// 是否为公开仓库（原type，自动填充）
@@ -110,22 +251,74 @@ type Options struct {
 	BeforeHook string
 	// 构建成功后的钩子命令
 	AfterHook string
+	// 保留的构建历史条数，0表示使用系统配置
+	KeepBuilds int
+	// 构建超时时间（单位秒），0表示使用系统配置
+	Timeout int
+	// 定时构建 latest 分支的cron表达式，如 0 3 * * *，为空时不定时构建
+	Schedule string
+	// 保留的标签（即语义化版本号）文档版本数，按版本号保留最新的，0表示不限制
+	KeepTags int
+	// 分支（即非语义化版本号）文档版本最近一次构建超过此天数即删除，0表示不限制
+	BranchMaxAge int
+	// 在版本列表中隐藏的文档版本（仍可访问）
+	Hidden []string
+	// 文档版本别名，键为别名，值为指向的分支或标签，如 stable -> v2.3.1
+	Aliases map[string]string
 	// 额外配置数据
 	Meta map[string]string
 }
 
 // Result 构建结果
 type Result struct {
+	// 构建ID
+	ID string
 	// 触发构建的分支或标签
 	Branch string
 	// 构建结果 passing表示true 其他表示false
 	Status bool
-	// 发起构建的来源
+	// 构建状态，比 Status 更详细
+	State BuildState
+	// 发起构建的来源（即触发方式）
 	Sender vars.Sender
+	// 构建开始时间
+	Stime string
 	// 构建完成时间（结束时）
 	Btime string
 	// 构建总花费时间（单位秒）
 	Usedtime int
+	// 构建脚本退出码
+	ExitCode int
+	// 构建失败的步骤（clone、venv、pip、sphinx、hook）
+	Step string
+	// 各步骤的执行结果
+	Steps []StepResult
+	// 构建所用的git提交
+	Commit string
+	// 提交作者
+	CommitAuthor string
+	// 提交说明（首行）
+	CommitSubject string
+	// 提交时间（ISO 8601 格式）
+	CommitTime string
+	// Sphinx构建的警告（含错误）数
+	Warnings int
+	// Sphinx构建的警告内容，过长时截断
+	WarningText string
+	// 构建日志文件路径
+	Log Path
+}
+
+// StepResult 构建步骤的执行结果
+type StepResult struct {
+	// 步骤名
+	Name string
+	// 是否成功
+	Status bool
+	// 花费时间（单位秒）
+	Usedtime int
+	// 失败原因
+	Error string
 }
 
 // OptionsWithResult 嵌套了 Options 和 Result 两种结构
@@ -144,12 +337,17 @@ type ProjectManager struct {
 // 数据 Key 命名：
 // 1. 项目名称写入 GBPK，自定义域名写入 GBDK，类型均为set
 // 2. 项目配置写入 BCK，类型为string，内容为json
-// 3. 项目构建结果写入 BRK，类型为hash，键为branch/tag
+// 3. 项目构建结果写入 BRK，类型为hash，键为branch/tag，仅保留每个分支最新一次
+// 4. 项目构建历史写入 BHK，类型为hash，键为构建ID；构建ID按时间倒序写入 BLK，类型为list
+// 5. 项目构建环境变量写入 BEK，类型为hash，键为变量名，值已加密
+// 6. 项目通知目标写入 BNK，类型为hash，键为目标ID；投递记录写入 BNLK，类型为list
 var (
 	// GBPK 文档项目名称集合，set类型
 	GBPK = "projects"
 	// GBDK 所有自定义的域名集合，set类型
 	GBDK = "domains"
+	// GBRK 正在运行的构建，hash类型，键为构建ID
+	GBRK = "running"
 )
 
 // BCK 生成文档项目配置Key，string类型
@@ -164,6 +362,18 @@ func BRK(projectName string) string {
 	return "builder:" + projectName
 }
 
+// BHK 生成构建历史Key，hash类型
+func BHK(projectName string) string {
+	projectName = strings.ToLower(projectName)
+	return "builds:" + projectName
+}
+
+// BLK 生成构建历史ID列表Key，list类型
+func BLK(projectName string) string {
+	projectName = strings.ToLower(projectName)
+	return "buildlist:" + projectName
+}
+
 // OptionKeyMap 转换 Options 结构体字段名大小写
 func OptionKeyMap(key string) string {
 	switch strings.ToLower(key) {
@@ -175,6 +385,8 @@ func OptionKeyMap(key string) string {
 		return "ShowNav"
 	case "hidegit":
 		return "HideGit"
+	case "failonwarning":
+		return "FailOnWarning"
 	case "defaultdomain":
 		return "DefaultDomain"
 	case "customdomain":
@@ -193,6 +405,14 @@ func OptionKeyMap(key string) string {
 		return "BeforeHook"
 	case "afterhook":
 		return "AfterHook"
+	case "keepbuilds":
+		return "KeepBuilds"
+	case "keeptags":
+		return "KeepTags"
+	case "branchmaxage":
+		return "BranchMaxAge"
+	case "outputdir":
+		return "OutputDir"
 	default:
 		return strings.Title(strings.ToLower(key))
 	}
@@ -285,6 +505,7 @@ func (pm *ProjectManager) GenerateOption(name, url string) (opt Options, err err
 		Name: name, URL: url, Version: PY3, Latest: pm.cfg.DefaultBranch(),
 		SourceDir: "docs", Lang: "en", ShowNav: true, HideGit: false, GSP: gsp,
 		DefaultDomain: name + "." + dn, Builder: HTMLBuilder, IsPublic: isPublic,
+		Engine: SphinxEngine,
 	}, nil
 }
 
@@ -293,10 +514,10 @@ func (pm *ProjectManager) SetOption(opt *Options, key string, value interface{})
 	p := reflect.ValueOf(opt)
 	f := p.Elem().FieldByName(key)
 	switch key {
-	case "Single", "Install", "ShowNav", "HideGit", "SSL", "IsPublic":
+	case "Single", "Install", "ShowNav", "HideGit", "SSL", "IsPublic", "FailOnWarning":
 		f.SetBool(value.(bool))
-	case "Version":
-		f.SetUint(uint64(value.(uint8)))
+	case "KeepBuilds", "Timeout", "KeepTags", "BranchMaxAge":
+		f.SetInt(int64(value.(int)))
 	default:
 		f.SetString(value.(string))
 	}
@@ -312,12 +533,28 @@ func (pm *ProjectManager) Create(name string, opt Options) error {
 	if pm.HasName(name) {
 		return errors.New("this project name already exists")
 	}
+	// 旧版本导出的项目没有文档引擎字段，默认为 Sphinx
+	if opt.Engine == "" {
+		opt.Engine = SphinxEngine
+	}
 	//校验必选项
 	if opt.URL == "" || opt.DefaultDomain == "" || opt.Latest == "" || opt.Lang == "" ||
-		(opt.Builder != HTMLBuilder && opt.Builder != DirHTMLBuilder && opt.Builder != SingleHTMLBuilder) ||
-		(opt.Version != PY2 && opt.Version != PY3) || opt.SourceDir == "" {
+		!opt.Builder.IsValid() || !opt.Inject.IsValid() || CheckFormats(opt.Formats) != nil ||
+		(opt.Engine != SphinxEngine && opt.Engine != MkDocsEngine) ||
+		opt.Version == "" || opt.SourceDir == "" {
 		return errors.New("required fields are missing")
 	}
+	if opt.Schedule != "" {
+		if _, err := util.ParseCron(opt.Schedule); err != nil {
+			return err
+		}
+	}
+	if err := opt.CheckCustom(); err != nil {
+		return err
+	}
+	if _, err := pm.PyPath(opt.Version); err != nil {
+		return err
+	}
 	domain := opt.CustomDomain
 	if domain != "" {
 		domain = strings.ToLower(domain)
@@ -434,13 +671,13 @@ func (pm *ProjectManager) GetNameOption(name, key string) (val string, err error
 	p := reflect.ValueOf(&opt)
 	f := p.Elem().FieldByName(key)
 	switch key {
-	case "Single", "Install", "ShowNav", "HideGit", "SSL", "IsPublic":
+	case "Single", "Install", "ShowNav", "HideGit", "SSL", "IsPublic", "FailOnWarning":
 		if f.Bool() {
 			return "true", nil
 		}
 		return "false", nil
-	case "Version":
-		return fmt.Sprint(f.Uint()), nil
+	case "KeepBuilds", "Timeout", "KeepTags", "BranchMaxAge":
+		return fmt.Sprint(f.Int()), nil
 	default:
 		if f.IsValid() {
 			return f.String(), nil
@@ -491,6 +728,12 @@ func (pm *ProjectManager) ListBuildset(name string) (builders []Result, err erro
 	return builders, nil
 }
 
+// DelBuildset 删除某个分支的构建结果
+func (pm *ProjectManager) DelBuildset(name, branch string) error {
+	_, err := pm.db.HDel(BRK(name), branch)
+	return err
+}
+
 // GetBuildset 获取某个构建结果
 func (pm *ProjectManager) GetBuildset(name, branch string) (builder Result, err error) {
 	val, err := pm.db.HGet(BRK(name), branch)
@@ -509,6 +752,72 @@ func (pm *ProjectManager) GetBuildset(name, branch string) (builder Result, err
 	return rst, nil
 }
 
+// LogPath 构建日志文件路径
+func (pm *ProjectManager) LogPath(name, id string) Path {
+	name = strings.ToLower(name)
+	return filepath.Join(pm.cfg.BaseDir(), "logs", name, id+".log")
+}
+
+// PyPath 获取Python版本对应的解释器路径，版本须在系统配置py分区中声明
+func (pm *ProjectManager) PyPath(ver PyVer) (string, error) {
+	py, ok := pm.cfg.Interpreters()[string(ver)]
+	if !ok {
+		return "", fmt.Errorf("undeclared python version: %s", ver)
+	}
+	return py, nil
+}
+
+// CacheDir 构建缓存目录，存放git镜像仓库与虚拟环境
+func (pm *ProjectManager) CacheDir(name string) Path {
+	name = strings.ToLower(name)
+	return filepath.Join(pm.cfg.BaseDir(), "cache", name)
+}
+
+// ClearCache 清除项目的构建缓存。先获取构建时使用的文件锁（镜像仓库的 .lock 与各虚拟环境的
+// <key>.lock），缓存正被构建使用时返回错误；锁文件本身保留，以免与等待中的构建锁住不同的文件。
+func (pm *ProjectManager) ClearCache(name string) error {
+	name = strings.ToLower(name)
+	if !pm.HasName(name) {
+		return errors.New("not found project")
+	}
+	busy := errors.New("cache is in use by a running build, try again later")
+	var clear func(dir string) error
+	clear = func(dir string) error {
+		ds, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		for _, d := range ds {
+			if strings.HasSuffix(d.Name(), ".lock") {
+				lock, err := util.TryLock(filepath.Join(dir, d.Name()))
+				if err != nil {
+					return busy
+				}
+				defer lock.Close()
+			}
+		}
+		for _, d := range ds {
+			path := filepath.Join(dir, d.Name())
+			switch {
+			case strings.HasSuffix(d.Name(), ".lock"):
+			case d.IsDir() && d.Name() == "venvs":
+				if err := clear(path); err != nil {
+					return err
+				}
+			default:
+				if err := os.RemoveAll(path); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return clear(pm.CacheDir(name))
+}
+
 func (pm *ProjectManager) renderNginx(opt *Options) error {
 	name := opt.Name
 	if opt.Lang == "" {
@@ -628,7 +937,7 @@ func (pm *ProjectManager) reloadNginx() error {
 	return nil
 }
 
-// BuildRecord 记录构建结果
+// BuildRecord 记录构建结果，同时写入分支最新结果与构建历史
 func (pm *ProjectManager) BuildRecord(name string, branchOrTag string, result Result) error {
 	name = strings.ToLower(name)
 	rst, err := json.Marshal(result)
@@ -641,6 +950,9 @@ func (pm *ProjectManager) BuildRecord(name string, branchOrTag string, result Re
 		return err
 	}
 
+	if result.ID != "" {
+		return pm.historyRecord(name, result.ID, string(rst))
+	}
 	return nil
 }
 
@@ -677,6 +989,19 @@ func (pm *ProjectManager) Remove(name string) error {
 			return err
 		}
 	}
+	LogsDir := filepath.Join(basedir, "logs", name)
+	if gtc.IsDir(LogsDir) {
+		err = os.RemoveAll(LogsDir)
+		if err != nil {
+			return err
+		}
+	}
+	if gtc.IsDir(pm.CacheDir(name)) {
+		err = os.RemoveAll(pm.CacheDir(name))
+		if err != nil {
+			return err
+		}
+	}
 	if gtc.IsFile(dftNgxFile) || gtc.IsFile(cstNgxFile) || gtc.IsFile(cstNgxFileOld) || gtc.IsFile(dftNgxFileOld) {
 		os.Remove(dftNgxFile)
 		os.Remove(cstNgxFile)
@@ -705,6 +1030,12 @@ func (pm *ProjectManager) Remove(name string) error {
 	}
 	tc.Del(BCK(name))
 	tc.Del(BRK(name))
+	tc.Del(BHK(name))
+	tc.Del(BLK(name))
+	tc.Del(BEK(name))
+	tc.Del(BNK(name))
+	tc.Del(BNLK(name))
+	tc.Del(BTK(name))
 	_, err = tc.Execute()
 	if err != nil {
 		return err
@@ -734,6 +1065,10 @@ func (pm *ProjectManager) Update(opt *Options, rule map[string]interface{}) (ok
 		}
 		ok = append(ok, field)
 	}
+	// 构建器与构建命令、输出目录可能在同一次更新中修改，全部更新后再检测
+	if err = opt.CheckCustom(); err != nil {
+		return
+	}
 
 	val, err := json.Marshal(opt)
 	if err != nil {
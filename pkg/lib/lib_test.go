@@ -0,0 +1,144 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestPyVer(t *testing.T) {
+	cases := map[string]PyVer{
+		`{"Version":2}`:     PY2,
+		`{"Version":3}`:     PY3,
+		`{"Version":"3.8"}`: PyVer("3.8"),
+	}
+	for data, ver := range cases {
+		var opt Options
+		if err := json.Unmarshal([]byte(data), &opt); err != nil {
+			t.Fatal(err)
+		}
+		if opt.Version != ver {
+			t.Fatalf("unmarshal %s error: %s", data, opt.Version)
+		}
+	}
+	var opt Options
+	if json.Unmarshal([]byte(`{"Version":true}`), &opt) == nil {
+		t.Fatal("should raise error for invalid version")
+	}
+}
+
+func TestIsStale(t *testing.T) {
+	now := time.Now()
+	beats := map[string]time.Time{
+		"alive": now.Add(-10 * time.Second),
+		"dead":  now.Add(-5 * time.Minute),
+	}
+	timeout := time.Minute
+	if isStale(Job{Worker: "alive"}, beats, now, timeout) {
+		t.Fatal("alive worker should not be stale")
+	}
+	if !isStale(Job{Worker: "dead"}, beats, now, timeout) {
+		t.Fatal("dead worker should be stale")
+	}
+	if !isStale(Job{Worker: "gone"}, beats, now, timeout) {
+		t.Fatal("removed worker should be stale")
+	}
+	if (Job{Name: "Rtfd", Branch: "master"}).Key() != "rtfd:master" {
+		t.Fatal("job key error")
+	}
+}
+
+func TestNotifyMatchEvent(t *testing.T) {
+	cases := []struct {
+		on          string
+		state, prev BuildState
+		event       NotifyEvent
+	}{
+		{"", StateFailing, StatePassing, EventFailure},
+		{"", StateTimeout, "", EventFailure},
+		{"", StatePartial, StatePassing, EventFailure},
+		{"", StatePassing, StatePartial, EventRecovery},
+		{"", StatePassing, StateFailing, EventRecovery},
+		{"", StatePassing, StatePassing, ""},
+		{"failure", StatePassing, StateFailing, ""},
+		{"recovery", StateFailing, StatePassing, ""},
+		{"always", StatePassing, StatePassing, EventSuccess},
+		{"always", StatePassing, StateTimeout, EventRecovery},
+		{"always", StateSkipped, StatePassing, ""},
+		{"always", StateCancelled, StatePassing, ""},
+		{"success, failure", StatePassing, "", EventSuccess},
+	}
+	for _, c := range cases {
+		nt := NotifyTarget{On: c.on}
+		if e := nt.MatchEvent(c.state, c.prev); e != c.event {
+			t.Fatalf("on %q %s after %s: got %q, want %q", c.on, c.state, c.prev, e, c.event)
+		}
+	}
+
+	checks := []struct {
+		t  NotifyTarget
+		ok bool
+	}{
+		{NotifyTarget{Type: NotifyWebhook, URL: "https://example.com/hook"}, true},
+		{NotifyTarget{Type: NotifySlack, URL: "ftp://example.com"}, false},
+		{NotifyTarget{Type: NotifySMTP, To: "a@example.com, b@example.com"}, true},
+		{NotifyTarget{Type: NotifySMTP}, false},
+		{NotifyTarget{Type: NotifyWebhook, URL: "https://example.com", On: "never"}, false},
+		{NotifyTarget{Type: "irc", URL: "https://example.com"}, false},
+	}
+	for _, c := range checks {
+		if err := c.t.Check(); (err == nil) != c.ok {
+			t.Fatalf("check %+v: %v", c.t, err)
+		}
+	}
+}
+
+func TestVersionAlias(t *testing.T) {
+	opt := Options{}
+	if err := opt.SetAlias("stable", "v2.3.1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range [][2]string{
+		{"latest", "v2.3.1"}, {"a/b", "v2.3.1"}, {"x", "x"}, {"x", "stable"},
+		{"v2.3.1", "master"}, {"..", "master"}, {"next", ""},
+	} {
+		if err := opt.SetAlias(c[0], c[1]); err == nil {
+			t.Fatalf("alias %s -> %s should fail", c[0], c[1])
+		}
+	}
+	if as := opt.AliasesOf("v2.3.1"); len(as) != 1 || as[0] != "stable" {
+		t.Fatalf("aliases of v2.3.1: %v", as)
+	}
+	if !opt.RemoveAlias("stable") || opt.RemoveAlias("stable") {
+		t.Fatal("remove alias error")
+	}
+
+	opt.SetHidden("dev", true)
+	opt.SetHidden("dev", true)
+	if !opt.IsHidden("dev") || len(opt.Hidden) != 1 {
+		t.Fatalf("hide error: %v", opt.Hidden)
+	}
+	opt.SetHidden("dev", false)
+	if opt.IsHidden("dev") {
+		t.Fatal("unhide error")
+	}
+}
+
+func TestCheckCustom(t *testing.T) {
+	cases := []struct {
+		opt Options
+		ok  bool
+	}{
+		{Options{Builder: HTMLBuilder}, true},
+		{Options{Builder: CustomBuilder, Command: "hugo", OutputDir: "public"}, true},
+		{Options{Builder: CustomBuilder, OutputDir: "public"}, false},
+		{Options{Builder: CustomBuilder, Command: "hugo"}, false},
+		{Options{Builder: CustomBuilder, Command: "hugo", OutputDir: "public/../../.."}, false},
+		{Options{Builder: CustomBuilder, Command: "hugo", OutputDir: "public/.."}, false},
+	}
+	for _, c := range cases {
+		if err := c.opt.CheckCustom(); (err == nil) != c.ok {
+			t.Fatalf("check %+v: %v", c.opt, err)
+		}
+	}
+}
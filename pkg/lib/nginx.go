@@ -128,6 +128,9 @@ server {
     {{- if .SSL -}}
         {{ .SSLCFG }}
     {{- end }}
+    location /_downloads/{{ .Lang }}/ {
+        alias {{ .DocsDir }}/{{ .Name }}/_downloads/{{ .Lang }}/;
+    }
 }
 `
 }
@@ -26,7 +26,7 @@ func TestRenderNginx(t *testing.T) {
 
 	opt.Single = true
 	rst, _ = opt.render()
-	if strings.Count(rst, "location") != 0 {
+	if strings.Count(rst, "location") != 1 || !strings.Contains(rst, "/rtfd/docs/test/_downloads/zh-CN/") {
 		t.Fatal("render single conf error")
 	}
 
@@ -0,0 +1,249 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 构建通知：项目的通知目标写入 BNK（hash类型，键为目标ID），投递记录写入 BNLK（list类型，最新在前）
+
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// NotifyType 通知目标类型
+type NotifyType string
+
+// NotifyEvent 触发通知的构建事件
+type NotifyEvent string
+
+const (
+	// NotifyWebhook 通用JSON webhook，设置密钥时请求头 X-Rtfd-Signature 为请求体的 HMAC-SHA256 签名
+	NotifyWebhook NotifyType = "webhook"
+	// NotifySlack Slack/Mattermost 风格的 incoming webhook
+	NotifySlack NotifyType = "slack"
+	// NotifySMTP 邮件，需在系统配置 smtp 分区设置发信服务器
+	NotifySMTP NotifyType = "smtp"
+
+	// EventFailure 构建失败或超时
+	EventFailure NotifyEvent = "failure"
+	// EventRecovery 构建由失败转为成功
+	EventRecovery NotifyEvent = "recovery"
+	// EventSuccess 构建成功
+	EventSuccess NotifyEvent = "success"
+	// EventAlways 仅用于设置，表示每次构建结束（跳过、取消的构建除外）均通知
+	EventAlways NotifyEvent = "always"
+)
+
+// 保留的投递记录条数
+const keepDeliveries = 100
+
+// NotifyTarget 通知目标
+type NotifyTarget struct {
+	// 目标ID
+	ID string
+	// 目标类型
+	Type NotifyType
+	// webhook、slack 的地址
+	URL string
+	// webhook 签名密钥
+	Secret string `json:",omitempty"`
+	// smtp 收件人，以半角逗号分隔多个
+	To string `json:",omitempty"`
+	// 触发通知的事件，以半角逗号分隔多个
+	On string
+}
+
+// Delivery 通知的投递记录
+type Delivery struct {
+	// 投递时间
+	Time string
+	// 通知目标ID
+	Target string
+	// 通知目标类型
+	Type NotifyType
+	// 构建ID
+	Build string
+	// 构建事件
+	Event NotifyEvent
+	// 尝试次数
+	Attempts int
+	// 是否投递成功
+	Status bool
+	// 最后一次失败原因
+	Error string `json:",omitempty"`
+}
+
+// BNK 生成文档项目通知目标Key，hash类型
+func BNK(projectName string) string {
+	return "notify:" + strings.ToLower(projectName)
+}
+
+// BNLK 生成文档项目通知投递记录Key，list类型
+func BNLK(projectName string) string {
+	return "notifylog:" + strings.ToLower(projectName)
+}
+
+// Events 解析目标设置的事件，未设置时为 failure、recovery
+func (t NotifyTarget) Events() []NotifyEvent {
+	var events []NotifyEvent
+	for _, e := range strings.Split(t.On, ",") {
+		if e = strings.TrimSpace(strings.ToLower(e)); e != "" {
+			events = append(events, NotifyEvent(e))
+		}
+	}
+	if len(events) == 0 {
+		events = []NotifyEvent{EventFailure, EventRecovery}
+	}
+	return events
+}
+
+// Check 校验通知目标
+func (t NotifyTarget) Check() error {
+	switch t.Type {
+	case NotifyWebhook, NotifySlack:
+		u, err := url.Parse(t.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("invalid notify url")
+		}
+	case NotifySMTP:
+		if t.To == "" {
+			return errors.New("empty notify recipient")
+		}
+		if _, err := mail.ParseAddressList(t.To); err != nil {
+			return fmt.Errorf("invalid notify recipient: %w", err)
+		}
+	default:
+		return errors.New("invalid notify type")
+	}
+	for _, e := range t.Events() {
+		if e != EventFailure && e != EventRecovery && e != EventSuccess && e != EventAlways {
+			return fmt.Errorf("invalid notify event: %s", e)
+		}
+	}
+	return nil
+}
+
+// buildEvent 根据本次与上次构建状态得出构建事件，跳过、取消的构建没有事件
+func buildEvent(state, prev BuildState) NotifyEvent {
+	switch state {
+	case StateFailing, StateTimeout, StatePartial:
+		return EventFailure
+	case StatePassing:
+		if prev == StateFailing || prev == StateTimeout || prev == StatePartial {
+			return EventRecovery
+		}
+		return EventSuccess
+	}
+	return ""
+}
+
+// MatchEvent 返回需要通知的构建事件，不需要通知时返回空；
+// prev 为该分支上一次构建的状态，无记录时为空
+func (t NotifyTarget) MatchEvent(state, prev BuildState) NotifyEvent {
+	e := buildEvent(state, prev)
+	if e == "" {
+		return ""
+	}
+	for _, f := range t.Events() {
+		if f == EventAlways || f == e {
+			return e
+		}
+	}
+	return ""
+}
+
+// AddNotify 添加或更新通知目标
+func (pm *ProjectManager) AddNotify(name string, t NotifyTarget) error {
+	if !pm.HasName(name) {
+		return errors.New("not found project")
+	}
+	if t.ID == "" {
+		return errors.New("empty notify id")
+	}
+	if err := t.Check(); err != nil {
+		return err
+	}
+	val, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = pm.db.HSet(BNK(name), t.ID, string(val))
+	return err
+}
+
+// RemoveNotify 删除通知目标
+func (pm *ProjectManager) RemoveNotify(name, id string) error {
+	n, err := pm.db.HDel(BNK(name), id)
+	if err == nil && n == 0 {
+		err = errors.New("not found notify target")
+	}
+	return err
+}
+
+// ListNotify 获取项目全部通知目标
+func (pm *ProjectManager) ListNotify(name string) (targets []NotifyTarget, err error) {
+	vals, err := pm.db.HGetAll(BNK(name))
+	if err != nil {
+		if err == redis.ErrNil {
+			err = nil
+		}
+		return
+	}
+	for _, val := range vals {
+		var t NotifyTarget
+		if e := json.Unmarshal([]byte(val), &t); e == nil {
+			targets = append(targets, t)
+		}
+	}
+	return
+}
+
+// AddDelivery 写入一条投递记录，仅保留最近的 keepDeliveries 条
+func (pm *ProjectManager) AddDelivery(name string, d Delivery) error {
+	val, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if _, err = pm.db.LPush(BNLK(name), string(val)); err != nil {
+		return err
+	}
+	_, err = pm.db.LTrim(BNLK(name), 0, keepDeliveries-1)
+	return err
+}
+
+// ListDelivery 获取最近的投递记录
+func (pm *ProjectManager) ListDelivery(name string, limit int) (ds []Delivery, err error) {
+	if limit < 1 || limit > keepDeliveries {
+		limit = keepDeliveries
+	}
+	vals, err := pm.db.LRange(BNLK(name), 0, limit-1)
+	if err != nil {
+		return
+	}
+	for _, val := range vals {
+		var d Delivery
+		if e := json.Unmarshal([]byte(val), &d); e == nil {
+			ds = append(ds, d)
+		}
+	}
+	return
+}
@@ -24,11 +24,71 @@ import (
 	"strconv"
 	"strings"
 
+	"pkg/tcw.im/rtfd/pkg/conf"
 	"pkg/tcw.im/rtfd/pkg/util"
+	"pkg/tcw.im/rtfd/vars"
 
 	"pkg.tcw.im/gtc"
 )
 
+// ErrNotUpdated 规则文件内容未变化，无需更新
+var ErrNotUpdated = errors.New("not updated")
+
+// RuleFromFile 读取规则文件（即源码仓库中的 .rtfd.ini），仅返回构建时参数
+func RuleFromFile(file string) (rule map[string]interface{}, err error) {
+	cfg, err := conf.New(file)
+	if err != nil {
+		return
+	}
+	rule = make(map[string]interface{})
+	for k, v := range cfg.SecHash("project") {
+		if gtc.StrInSlice(k, []string{"latest", "engine"}) {
+			rule[k] = v
+		}
+	}
+	for k, v := range cfg.SecHash("sphinx") {
+		if gtc.StrInSlice(k, []string{"sourcedir", "lang", "builder", "formats", "fail_on_warning"}) {
+			rule[k] = v
+		}
+	}
+	for k, v := range cfg.SecHash("custom") {
+		if gtc.StrInSlice(k, []string{"command", "output"}) {
+			rule[k] = v
+		}
+	}
+	for k, v := range cfg.SecHash("python") {
+		if gtc.StrInSlice(k, []string{"version", "requirement", "install", "index"}) {
+			rule[k] = v
+		}
+	}
+	return rule, nil
+}
+
+// UpdateFromFile 依照规则文件更新文档项目的构建时参数，
+// 文件内容与上次更新时相同则返回 ErrNotUpdated
+func (pm *ProjectManager) UpdateFromFile(opt *Options, file string) (ok []string, fail []string, err error) {
+	if !gtc.IsFile(file) {
+		err = errors.New("not found file")
+		return
+	}
+	md5 := opt.GetMeta(vars.PUFMD5)
+	fileMD5, _ := gtc.MD5File(file)
+	if md5 != "" && fileMD5 != "" && fileMD5 == md5 {
+		err = ErrNotUpdated
+		return
+	}
+	rule, err := RuleFromFile(file)
+	if err != nil {
+		return
+	}
+	if len(rule) <= 0 {
+		err = errors.New("empty rule")
+		return
+	}
+	opt.UpdateMeta(vars.PUFMD5, fileMD5)
+	return pm.Update(opt, rule)
+}
+
 // 更新文档项目配置结构体
 type updateHook struct {
 	pm     *ProjectManager
@@ -61,18 +121,40 @@ func (u *updateHook) handle(field string) (fn func(value interface{}) error, err
 		fn = u.showNav
 	case "hidegit":
 		fn = u.hideGit
+	case "failonwarning", "fail_on_warning":
+		fn = u.failOnWarning
 	case "secret":
 		fn = u.secret
 	case "customdomain", "domain":
 		fn = u.customDomain
 	case "builder":
 		fn = u.builder
+	case "engine":
+		fn = u.engine
+	case "inject":
+		fn = u.inject
+	case "formats":
+		fn = u.formats
+	case "command":
+		fn = u.command
+	case "outputdir", "output":
+		fn = u.outputDir
 	case "beforehook", "before":
 		fn = u.beforeHook
 	case "afterhook", "after":
 		fn = u.afterHook
 	case "ssl":
 		fn = u.ssl
+	case "keepbuilds":
+		fn = u.keepBuilds
+	case "timeout":
+		fn = u.timeout
+	case "schedule":
+		fn = u.schedule
+	case "keeptags":
+		fn = u.keepTags
+	case "branchmaxage":
+		fn = u.branchMaxAge
 	case "meta":
 		fn = u.meta
 	default:
@@ -131,14 +213,10 @@ func (u *updateHook) latest(value interface{}) error {
 }
 
 func (u *updateHook) version(value interface{}) error {
-	v, err := strconv.Atoi(value.(string))
-	if err != nil {
+	ver := PyVer(strings.TrimSpace(value.(string)))
+	if _, err := u.pm.PyPath(ver); err != nil {
 		return err
 	}
-	ver := PyVer(v)
-	if ver != PY2 && ver != PY3 {
-		return errors.New("invalid version value")
-	}
 	u.opt.Version = ver
 	return nil
 }
@@ -195,6 +273,11 @@ func (u *updateHook) hideGit(value interface{}) error {
 	return nil
 }
 
+func (u *updateHook) failOnWarning(value interface{}) error {
+	u.opt.FailOnWarning = gtc.IsTrue(value.(string))
+	return nil
+}
+
 func (u *updateHook) secret(value interface{}) error {
 	u.opt.Secret = value.(string)
 	return nil
@@ -235,7 +318,53 @@ func (u *updateHook) customDomain(value interface{}) error {
 }
 
 func (u *updateHook) builder(value interface{}) error {
-	u.opt.Builder = value.(BuilderType)
+	b := BuilderType(strings.ToLower(value.(string)))
+	if !b.IsValid() {
+		return errors.New("invalid builder value")
+	}
+	u.opt.Builder = b
+	return nil
+}
+
+func (u *updateHook) inject(value interface{}) error {
+	m := InjectMode(strings.ToLower(value.(string)))
+	if m == "" || !m.IsValid() {
+		return errors.New("invalid inject value")
+	}
+	u.opt.Inject = m
+	return nil
+}
+
+func (u *updateHook) formats(value interface{}) error {
+	f := strings.ToLower(value.(string))
+	if err := CheckFormats(f); err != nil {
+		return err
+	}
+	u.opt.Formats = f
+	return nil
+}
+
+func (u *updateHook) command(value interface{}) error {
+	u.opt.Command = value.(string)
+	return nil
+}
+
+func (u *updateHook) outputDir(value interface{}) error {
+	od := value.(string)
+	// 检测od，避免安全风险（构建前会删除输出目录）
+	if clean, ok := util.SubPath(od); od != "" && (!ok || clean == ".") {
+		return errors.New("illegal outputdir")
+	}
+	u.opt.OutputDir = od
+	return nil
+}
+
+func (u *updateHook) engine(value interface{}) error {
+	e := Engine(strings.ToLower(value.(string)))
+	if e != SphinxEngine && e != MkDocsEngine {
+		return errors.New("invalid engine value")
+	}
+	u.opt.Engine = e
 	return nil
 }
 
@@ -249,6 +378,65 @@ func (u *updateHook) afterHook(value interface{}) error {
 	return nil
 }
 
+func (u *updateHook) keepBuilds(value interface{}) error {
+	n, err := strconv.Atoi(value.(string))
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return errors.New("invalid keepbuilds value")
+	}
+	u.opt.KeepBuilds = n
+	return nil
+}
+
+func (u *updateHook) timeout(value interface{}) error {
+	n, err := strconv.Atoi(value.(string))
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return errors.New("invalid timeout value")
+	}
+	u.opt.Timeout = n
+	return nil
+}
+
+func (u *updateHook) keepTags(value interface{}) error {
+	n, err := strconv.Atoi(value.(string))
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return errors.New("invalid keeptags value")
+	}
+	u.opt.KeepTags = n
+	return nil
+}
+
+func (u *updateHook) branchMaxAge(value interface{}) error {
+	n, err := strconv.Atoi(value.(string))
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return errors.New("invalid branchmaxage value")
+	}
+	u.opt.BranchMaxAge = n
+	return nil
+}
+
+func (u *updateHook) schedule(value interface{}) error {
+	spec := strings.TrimSpace(value.(string))
+	if spec != "" {
+		if _, err := util.ParseCron(spec); err != nil {
+			return err
+		}
+	}
+	u.opt.Schedule = spec
+	return nil
+}
+
 func (u *updateHook) ssl(value interface{}) error {
 	v := value.(string)
 
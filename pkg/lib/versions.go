@@ -0,0 +1,136 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package lib
+
+import (
+	"errors"
+	"strings"
+)
+
+// CheckVersionName 检测文档版本名（即分支、标签或别名）是否可用作文档目录
+func CheckVersionName(v string) error {
+	if v == "" || v == "latest" || strings.HasPrefix(v, ".") || strings.HasPrefix(v, "/") ||
+		strings.Contains(v, "..") {
+		return errors.New("invalid version: " + v)
+	}
+	return nil
+}
+
+// IsHidden 文档版本是否已隐藏
+func (opt Options) IsHidden(v string) bool {
+	for _, h := range opt.Hidden {
+		if h == v {
+			return true
+		}
+	}
+	return false
+}
+
+// SetHidden 隐藏或取消隐藏文档版本
+func (opt *Options) SetHidden(v string, hidden bool) {
+	vs := make([]string, 0, len(opt.Hidden))
+	for _, h := range opt.Hidden {
+		if h != v {
+			vs = append(vs, h)
+		}
+	}
+	if hidden {
+		vs = append(vs, v)
+	}
+	opt.Hidden = vs
+}
+
+// SetAlias 设置文档版本别名，别名不能含 / 且不能指向另一个别名
+func (opt *Options) SetAlias(alias, target string) error {
+	if err := CheckVersionName(alias); err != nil {
+		return err
+	}
+	if err := CheckVersionName(target); err != nil {
+		return err
+	}
+	if strings.Contains(alias, "/") {
+		return errors.New("alias cannot contain /")
+	}
+	if alias == target {
+		return errors.New("alias is the same as target")
+	}
+	if _, ok := opt.Aliases[target]; ok {
+		return errors.New("target is an alias: " + target)
+	}
+	for a, t := range opt.Aliases {
+		if t == alias {
+			return errors.New("alias is the target of " + a)
+		}
+	}
+	if opt.Aliases == nil {
+		opt.Aliases = make(map[string]string)
+	}
+	opt.Aliases[alias] = target
+	return nil
+}
+
+// RemoveAlias 删除文档版本别名，返回是否存在
+func (opt *Options) RemoveAlias(alias string) bool {
+	if _, ok := opt.Aliases[alias]; !ok {
+		return false
+	}
+	delete(opt.Aliases, alias)
+	return true
+}
+
+// AliasesOf 指向某个文档版本的所有别名
+func (opt Options) AliasesOf(target string) (aliases []string) {
+	for a, t := range opt.Aliases {
+		if t == target {
+			aliases = append(aliases, a)
+		}
+	}
+	return
+}
+
+// BTK 生成文档项目远程仓库标签Key，set类型，用于区分文档版本是标签还是分支
+func BTK(projectName string) string {
+	return "tags:" + strings.ToLower(projectName)
+}
+
+// SetTags 保存远程仓库的标签名，替换原有记录
+func (pm *ProjectManager) SetTags(name string, tags []string) error {
+	tc := pm.db.Pipeline()
+	tc.Del(BTK(name))
+	if len(tags) > 0 {
+		args := make([]interface{}, len(tags))
+		for i, t := range tags {
+			args[i] = t
+		}
+		tc.SAdd(BTK(name), args...)
+	}
+	_, err := tc.Execute()
+	return err
+}
+
+// Tags 最近一次保存的远程仓库标签名
+func (pm *ProjectManager) Tags(name string) (map[string]bool, error) {
+	tags, err := pm.db.SMembers(BTK(name))
+	if err != nil {
+		return nil, err
+	}
+	isTag := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		isTag[t] = true
+	}
+	return isTag, nil
+}
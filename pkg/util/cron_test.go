@@ -0,0 +1,56 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	errs := []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *",
+		"* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"}
+	for _, spec := range errs {
+		if _, err := ParseCron(spec); err == nil {
+			t.Fatalf("%q should be invalid", spec)
+		}
+	}
+
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	// 2021-06-06 是周日
+	cases := []struct {
+		spec  string
+		time  string
+		match bool
+	}{
+		{"0 3 * * *", "2021-06-06 03:00", true},
+		{"0 3 * * *", "2021-06-06 03:01", false},
+		{"@daily", "2021-06-06 00:00", true},
+		{"@hourly", "2021-06-06 13:00", true},
+		{"*/15 * * * *", "2021-06-06 13:45", true},
+		{"*/15 * * * *", "2021-06-06 13:46", false},
+		{"5/20 * * * *", "2021-06-06 13:25", true},
+		{"0 9-17/4 * * *", "2021-06-06 13:00", true},
+		{"0 9-17/4 * * *", "2021-06-06 15:00", false},
+		{"0 0 * * 7", "2021-06-06 00:00", true},
+		{"0 0 * * 1-5", "2021-06-06 00:00", false},
+		{"0 0 1,15 * *", "2021-06-15 00:00", true},
+		// 日与周均有限定时满足其一即可
+		{"0 0 1 * 0", "2021-06-06 00:00", true},
+		{"0 0 1 * 1", "2021-06-06 00:00", false},
+		{"0 0 * 7 *", "2021-06-06 00:00", false},
+	}
+	for _, c := range cases {
+		cron, err := ParseCron(c.spec)
+		if err != nil {
+			t.Fatalf("parse %q error: %s", c.spec, err)
+		}
+		if cron.Match(at(c.time)) != c.match {
+			t.Fatalf("%q match %s should be %v", c.spec, c.time, c.match)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+/*
+   Copyright 2021 Hiroshi.tao
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// 语义化版本的解析与比较，用于按版本号排序、保留文档版本
+
+package util
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Semver 语义化版本，如 v1.2.3-rc.1
+type Semver struct {
+	Major, Minor, Patch int
+	// 预发布标识，如 rc.1
+	Pre string
+}
+
+// ParseSemver 解析版本号，允许 v 前缀与省略修订号（如 v1.2），至少需要主版本号与次版本号，
+// 以免把 2021 这类纯数字名称当作版本号，忽略 + 之后的构建信息
+func ParseSemver(s string) (v Semver, ok bool) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.Pre = s[i+1:]
+		if v.Pre == "" {
+			return v, false
+		}
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return v, false
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		*nums[i] = n
+	}
+	return v, true
+}
+
+// IsSemver 是否为语义化版本号
+func IsSemver(s string) bool {
+	_, ok := ParseSemver(s)
+	return ok
+}
+
+// Compare 比较版本，a < b 返回 -1，相等返回 0，a > b 返回 1；预发布版本低于正式版本
+func (a Semver) Compare(b Semver) int {
+	for _, d := range [][2]int{{a.Major, b.Major}, {a.Minor, b.Minor}, {a.Patch, b.Patch}} {
+		if d[0] != d[1] {
+			return cmpInt(d[0], d[1])
+		}
+	}
+	switch {
+	case a.Pre == b.Pre:
+		return 0
+	case a.Pre == "":
+		return 1
+	case b.Pre == "":
+		return -1
+	}
+	ap, bp := strings.Split(a.Pre, "."), strings.Split(b.Pre, ".")
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		if ap[i] == bp[i] {
+			continue
+		}
+		an, aerr := strconv.Atoi(ap[i])
+		bn, berr := strconv.Atoi(bp[i])
+		switch {
+		case aerr == nil && berr == nil:
+			return cmpInt(an, bn)
+		case aerr == nil:
+			// 数字标识低于字母标识
+			return -1
+		case berr == nil:
+			return 1
+		case ap[i] < bp[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return cmpInt(len(ap), len(bp))
+}
+
+// CompareSemver 比较两个版本号字符串，不是语义化版本的低于语义化版本，二者均不是时按字符串比较
+func CompareSemver(a, b string) int {
+	av, aok := ParseSemver(a)
+	bv, bok := ParseSemver(b)
+	switch {
+	case aok && bok:
+		if c := av.Compare(bv); c != 0 {
+			return c
+		}
+	case aok:
+		return 1
+	case bok:
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+// SortVersions 排序文档版本：latest 在最前，stable 其次，然后是分支（按名称），
+// 最后是标签（isTag 中的版本，语义化版本号按版本号倒序排在其他标签之前）
+func SortVersions(vs []string, isTag map[string]bool) {
+	rank := func(v string) int {
+		switch {
+		case v == "latest":
+			return 0
+		case v == "stable":
+			return 1
+		case isTag[v]:
+			return 3
+		}
+		return 2
+	}
+	sort.SliceStable(vs, func(i, j int) bool {
+		ri, rj := rank(vs[i]), rank(vs[j])
+		if ri != rj {
+			return ri < rj
+		}
+		if ri == 3 {
+			return CompareSemver(vs[i], vs[j]) > 0
+		}
+		return vs[i] < vs[j]
+	})
+}
+
+// StableVersion 标签 vs 中版本号最大的正式（非预发布）版本，没有时返回空
+func StableVersion(vs []string) (stable string) {
+	var max Semver
+	for _, v := range vs {
+		sv, ok := ParseSemver(v)
+		if !ok || sv.Pre != "" {
+			continue
+		}
+		if stable == "" || sv.Compare(max) > 0 {
+			stable, max = v, sv
+		}
+	}
+	return
+}
+
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseSemver(t *testing.T) {
+	oks := map[string]Semver{
+		"v1.2.3":        {1, 2, 3, ""},
+		"1.2":           {1, 2, 0, ""},
+		"1.0.0-rc.1":    {1, 0, 0, "rc.1"},
+		"1.0.0+build.5": {1, 0, 0, ""},
+	}
+	for s, want := range oks {
+		v, ok := ParseSemver(s)
+		if !ok || v != want {
+			t.Fatalf("parse %s error: %+v", s, v)
+		}
+	}
+	for _, s := range []string{"", "master", "v1.2.3.4", "1.x", "1.0-", "release/1.0", "v", "v2", "2021"} {
+		if IsSemver(s) {
+			t.Fatalf("%s should not be semver", s)
+		}
+	}
+}
+
+func TestCompareSemver(t *testing.T) {
+	vs := []string{"v1.10.0", "dev", "v1.2.0", "1.0.0-rc.1", "1.0.0", "1.0.0-beta", "1.0.0-rc.10", "1.0.0-rc.2", "master"}
+	sort.Slice(vs, func(i, j int) bool { return CompareSemver(vs[i], vs[j]) < 0 })
+	want := "dev,master,1.0.0-beta,1.0.0-rc.1,1.0.0-rc.2,1.0.0-rc.10,1.0.0,v1.2.0,v1.10.0"
+	if strings.Join(vs, ",") != want {
+		t.Fatalf("sort error: %v", vs)
+	}
+	if CompareSemver("v1.0", "1.0.0") == 0 || CompareSemver("1.0.0", "1.0.0") != 0 {
+		t.Fatal("equal versions should fall back to string order")
+	}
+}
+
+func TestSortVersions(t *testing.T) {
+	vs := []string{"v1.2.0", "master", "v1.10.0", "latest", "dev", "stable", "v2.0.0-rc.1", "feature/x", "2.0", "release-1"}
+	isTag := map[string]bool{"v1.2.0": true, "v1.10.0": true, "v2.0.0-rc.1": true, "release-1": true}
+	SortVersions(vs, isTag)
+	// 2.0 是维护分支，release-1 是非语义化版本号的标签
+	want := "latest,stable,2.0,dev,feature/x,master,v2.0.0-rc.1,v1.10.0,v1.2.0,release-1"
+	if strings.Join(vs, ",") != want {
+		t.Fatalf("sort error: %v", vs)
+	}
+	if s := StableVersion(vs[len(vs)-4:]); s != "v1.10.0" {
+		t.Fatalf("stable should be v1.10.0, got %q", s)
+	}
+	if s := StableVersion([]string{"master", "v1.0.0-beta"}); s != "" {
+		t.Fatalf("no stable version, got %q", s)
+	}
+}
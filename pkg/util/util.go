@@ -20,16 +20,26 @@ package util
 
 import (
 	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/url"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	"pkg/tcw.im/rtfd/vars"
@@ -37,10 +47,16 @@ import (
 
 var (
 	namePat = regexp.MustCompile(`^[a-zA-Z][0-9a-zA-Z\_\-]{1,100}$`)
+	envPat  = regexp.MustCompile(`^[a-zA-Z_][0-9a-zA-Z_]*$`)
 	dnPat   = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-]{0,62}(\.[a-zA-Z0-9][a-zA-Z0-9-]{0,62})*(\.[a-zA-Z][a-zA-Z0-9]{0,10}){1}$`)
 	LLPat   = regexp.MustCompile(`^[a-z\_][0-9a-z\_]{1,63}$`)
 )
 
+// IsEnvName 判断name是否为合法的环境变量名
+func IsEnvName(name string) bool {
+	return envPat.MatchString(name)
+}
+
 // IsProjectName 判断name是否为合法名称
 func IsProjectName(name string) bool {
 	if name != "" && namePat.MatchString(name) {
@@ -61,7 +77,33 @@ func RunCmd(name string, args ...string) (exitCode int, out string, err error) {
 
 // RunCmdStream 在控制台实时输出命令返回信息
 func RunCmdStream(name string, args []string, f func(line string)) error {
+	return streamCmd(exec.Command(name, args...), nil, f)
+}
+
+// RunCmdStreamGroup 同 RunCmdStream，但命令运行在独立的进程组中，
+// 启动成功后以进程ID（亦即进程组ID）调用 started，可用 KillGroup 终止整个进程树
+func RunCmdStreamGroup(name string, args []string, started func(pid int), f func(line string)) error {
+	return RunCmdStreamIn("", nil, name, args, started, f)
+}
+
+// RunCmdStreamIn 同 RunCmdStreamGroup，可设置命令的工作目录与环境变量（为空时继承当前进程）
+func RunCmdStreamIn(dir string, env []string, name string, args []string, started func(pid int), f func(line string)) error {
 	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return streamCmd(cmd, started, f)
+}
+
+// KillGroup 强制终止进程组内所有进程
+func KillGroup(pgid int) error {
+	if pgid <= 0 {
+		return errors.New("invalid process group id")
+	}
+	return syscall.Kill(-pgid, syscall.SIGKILL)
+}
+
+func streamCmd(cmd *exec.Cmd, started func(pid int), f func(line string)) error {
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return err
@@ -72,6 +114,9 @@ func RunCmdStream(name string, args []string, f func(line string)) error {
 	if err = cmd.Start(); err != nil {
 		return err
 	}
+	if started != nil {
+		started(cmd.Process.Pid)
+	}
 
 	//从管道中实时循环读取输出流中的一行内容
 	reader := bufio.NewReader(stdout)
@@ -88,6 +133,40 @@ func RunCmdStream(name string, args []string, f func(line string)) error {
 	return cmd.Wait()
 }
 
+// Lock 对文件加排他锁（flock），阻塞直到获得锁，关闭返回的文件即释放锁
+func Lock(path string) (*os.File, error) {
+	return lockFile(path, syscall.LOCK_EX)
+}
+
+// TryLock 同 Lock，但锁已被占用时立即返回错误
+func TryLock(path string) (*os.File, error) {
+	return lockFile(path, syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+func lockFile(path string, how int) (*os.File, error) {
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(fd.Fd()), how); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return fd, nil
+}
+
+// ExitCode 从命令执行返回的错误中获取退出码，无错误时为0，非退出错误时为-1
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return ee.ExitCode()
+	}
+	return -1
+}
+
 // IsIP 检测IPv4、IPv6
 func IsIP(str string) bool {
 	return net.ParseIP(str) != nil
@@ -113,6 +192,34 @@ func GetNow() string {
 	return time.Now().Format("2006-01-02 15:04:05")
 }
 
+// SubPath 清理相对路径，ok 表示其仍位于所在目录之内（清理后为 . 即目录本身），
+// 绝对路径或以 .. 跳出目录的路径（如 public/../..）均不是
+func SubPath(path string) (clean string, ok bool) {
+	if path == "" || filepath.IsAbs(path) {
+		return "", false
+	}
+	clean = filepath.Clean(path)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return clean, true
+}
+
+// HumanSize 以 B、K、M、G 为单位格式化字节数
+func HumanSize(n int64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	size := float64(n)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d%s", n, units[0])
+	}
+	return fmt.Sprintf("%.1f%s", size, units[i])
+}
+
 // CheckGitURL 检查url是否为支持的git地址。
 // 当无error时，返回public或private表示公共、私有仓库；
 // 当有error时，返回错误提示。
@@ -179,6 +286,121 @@ func GitUserRepo(rawurl string) (fullname string, err error) {
 	return strings.ToLower(fullname), nil
 }
 
+// GitRemoteHead 通过 git ls-remote 获取远程仓库中分支或标签所指向的提交
+func GitRemoteHead(rawurl, ref string) (sha string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(
+		ctx, "git", "ls-remote", rawurl,
+		"refs/heads/"+ref, "refs/tags/"+ref, "refs/tags/"+ref+"^{}",
+	)
+	// 禁止交互式询问认证信息
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.Output()
+	if err != nil {
+		return
+	}
+	sha = parseLsRemote(string(out), ref)
+	if sha == "" {
+		err = errors.New("not found ref")
+	}
+	return
+}
+
+// parseLsRemote 解析 git ls-remote 的输出，同名时分支优先（同 git clone --branch），
+// 附注标签以其指向的提交为准
+func parseLsRemote(out, ref string) string {
+	refs := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			refs[fields[1]] = fields[0]
+		}
+	}
+	for _, r := range []string{"refs/heads/" + ref, "refs/tags/" + ref + "^{}", "refs/tags/" + ref} {
+		if sha, ok := refs[r]; ok {
+			return sha
+		}
+	}
+	return ""
+}
+
+// GitRemoteRefs 通过 git ls-remote 获取远程仓库中全部的分支与标签名
+func GitRemoteRefs(rawurl string) (branches, tags []string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", "--heads", "--tags", rawurl)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.Output()
+	if err != nil {
+		return
+	}
+	branches, tags = parseRemoteRefs(string(out))
+	return
+}
+
+// parseRemoteRefs 解析 git ls-remote 的输出为分支与标签名，忽略附注标签的 ^{} 条目
+func parseRemoteRefs(out string) (branches, tags []string) {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.HasSuffix(fields[1], "^{}") {
+			continue
+		}
+		if b := strings.TrimPrefix(fields[1], "refs/heads/"); b != fields[1] {
+			branches = append(branches, b)
+		} else if t := strings.TrimPrefix(fields[1], "refs/tags/"); t != fields[1] {
+			tags = append(tags, t)
+		}
+	}
+	return
+}
+
+// Encrypt 使用 AES-256-GCM 加密，密钥由 secret 经 sha256 生成，返回 base64 编码的随机数与密文
+func Encrypt(secret, plaintext string) (string, error) {
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	ct := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(ct), nil
+}
+
+// Decrypt 解密 Encrypt 的结果，密钥错误或密文被篡改时返回错误
+func Decrypt(secret, ciphertext string) (string, error) {
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("invalid ciphertext")
+	}
+	pt, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(pt), nil
+}
+
+func newGCM(secret string) (cipher.AEAD, error) {
+	if secret == "" {
+		return nil, errors.New("empty secret")
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
 // HMACSha1 以hmac加盐方式检测字符串sha1值
 func HMACSha1(key, text string) string {
 	return HMACSha1Byte([]byte(key), []byte(text))
@@ -1,8 +1,10 @@
 package util
 
 import (
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestUtil(t *testing.T) {
@@ -37,6 +39,23 @@ func TestUtil(t *testing.T) {
 	if err != nil {
 		t.Fatal("run cmd error")
 	}
+	if ExitCode(nil) != 0 {
+		t.Fatal("exit code of nil error should be 0")
+	}
+	if ExitCode(RunCmdStream("sh", []string{"-c", "exit 3"}, nil)) != 3 {
+		t.Fatal("exit code should be 3")
+	}
+	if ExitCode(RunCmdStream("/non-existent-cmd", nil, nil)) != -1 {
+		t.Fatal("exit code of start error should be -1")
+	}
+
+	stime := time.Now()
+	err = RunCmdStreamGroup("sh", []string{"-c", "sleep 30 & sleep 30"}, func(pid int) {
+		go KillGroup(pid)
+	}, nil)
+	if err == nil || time.Since(stime) > 10*time.Second {
+		t.Fatal("kill process group fail")
+	}
 
 	hs1k := "hello world!"
 	hs1v := "9bf0f4bf184c31eea044ee583ef35aa9532337e6"
@@ -48,6 +67,58 @@ func TestUtil(t *testing.T) {
 	}
 }
 
+func TestLock(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "lock")
+	fd, err := Lock(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TryLock(f); err == nil {
+		t.Fatal("lock should be held")
+	}
+	fd.Close()
+	fd, err = TryLock(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Close()
+}
+
+func TestParseLsRemote(t *testing.T) {
+	out := `1111111111111111111111111111111111111111	refs/heads/dev
+2222222222222222222222222222222222222222	refs/tags/v1.0
+3333333333333333333333333333333333333333	refs/tags/v1.0^{}
+4444444444444444444444444444444444444444	refs/tags/v1.1
+`
+	cases := map[string]string{
+		"dev":    "1111111111111111111111111111111111111111",
+		"v1.0":   "3333333333333333333333333333333333333333",
+		"v1.1":   "4444444444444444444444444444444444444444",
+		"master": "",
+	}
+	for ref, sha := range cases {
+		if parseLsRemote(out, ref) != sha {
+			t.Fatalf("parse ls-remote %s error", ref)
+		}
+	}
+}
+
+func TestParseRemoteRefs(t *testing.T) {
+	out := `1111111111111111111111111111111111111111	refs/heads/master
+2222222222222222222222222222222222222222	refs/heads/feature/x
+3333333333333333333333333333333333333333	refs/tags/v1.0
+4444444444444444444444444444444444444444	refs/tags/v1.0^{}
+5555555555555555555555555555555555555555	refs/pull/1/head
+`
+	branches, tags := parseRemoteRefs(out)
+	if strings.Join(branches, ",") != "master,feature/x" {
+		t.Fatalf("parse branches error: %v", branches)
+	}
+	if strings.Join(tags, ",") != "v1.0" {
+		t.Fatalf("parse tags error: %v", tags)
+	}
+}
+
 func TestGitURL(t *testing.T) {
 	giturls := []struct {
 		url    string
@@ -174,3 +245,51 @@ func TestDNS(t *testing.T) {
 		}
 	}
 }
+
+func TestEncrypt(t *testing.T) {
+	ct, err := Encrypt("secret", "token-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct2, _ := Encrypt("secret", "token-value"); ct2 == ct {
+		t.Fatal("ciphertext should use random nonce")
+	}
+	pt, err := Decrypt("secret", ct)
+	if err != nil || pt != "token-value" {
+		t.Fatalf("decrypt error: %v %s", err, pt)
+	}
+	if _, err := Decrypt("other", ct); err == nil {
+		t.Fatal("decrypt with wrong secret should fail")
+	}
+	if _, err := Encrypt("", "x"); err == nil {
+		t.Fatal("empty secret should fail")
+	}
+	if !IsEnvName("PYPI_TOKEN") || !IsEnvName("_x1") || IsEnvName("1A") || IsEnvName("A-B") {
+		t.Fatal("env name check error")
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	cases := map[int64]string{
+		0: "0B", 1023: "1023B", 1024: "1.0K", 1536: "1.5K", 5 << 20: "5.0M", 3 << 30: "3.0G",
+	}
+	for n, s := range cases {
+		if v := HumanSize(n); v != s {
+			t.Fatalf("size %d: got %s, want %s", n, v, s)
+		}
+	}
+}
+
+func TestSubPath(t *testing.T) {
+	oks := map[string]string{"docs": "docs", "public/": "public", "a/../b": "b", ".": ".", "a/..": "."}
+	for p, want := range oks {
+		if clean, ok := SubPath(p); !ok || clean != want {
+			t.Fatalf("%s should be inside as %s, got %q %v", p, want, clean, ok)
+		}
+	}
+	for _, p := range []string{"", "/tmp", "..", "../x", "public/../../..", "a/../../b"} {
+		if _, ok := SubPath(p); ok {
+			t.Fatalf("%s should be outside", p)
+		}
+	}
+}
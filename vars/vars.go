@@ -30,6 +30,8 @@ const (
 	CLISender Sender = "cli"
 	// WebhookSender 从git webhook发起自动构建
 	WebhookSender Sender = "webhook"
+	// ScheduleSender 由项目的定时构建发起
+	ScheduleSender Sender = "schedule"
 )
 
 const (